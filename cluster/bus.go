@@ -0,0 +1,116 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cluster relays the broadcasts and targeted sends of nettyws between nodes.
+//
+// A Node binds a Websocket to a Bus, the messages to the connections of the other nodes
+// are published to the Bus and delivered by the receiving nodes. The Hub relays the nodes
+// in process, the Mesh relays the nodes over TCP connections.
+package cluster
+
+import (
+	"sync"
+)
+
+// envelope kinds
+const (
+	KindBroadcast = iota
+	KindConn
+	KindUser
+)
+
+// Envelope is the message relayed between nodes.
+type Envelope struct {
+	// Kind is KindBroadcast, KindConn or KindUser.
+	Kind int
+	// Node is the id of the origin node.
+	Node string
+	// Target is the cluster conn id of KindConn or the user key of KindUser.
+	Target string
+	// Data is the message.
+	Data []byte
+}
+
+// Bus relays the envelopes between nodes, the envelopes are delivered at most once.
+type Bus interface {
+	// Publish sends the envelope to the other nodes.
+	Publish(envelope *Envelope) error
+	// Subscribe sets the handler of the envelopes from the other nodes.
+	Subscribe(handler func(envelope *Envelope))
+	// Close leaves the cluster.
+	Close() error
+}
+
+// Hub relays the nodes in process.
+type Hub struct {
+	mutex sync.RWMutex
+	buses map[*hubBus]struct{}
+}
+
+// NewHub create an in process hub.
+func NewHub() *Hub {
+	return &Hub{buses: make(map[*hubBus]struct{})}
+}
+
+// Join returns the Bus of a new node.
+func (h *Hub) Join() Bus {
+	bus := &hubBus{hub: h}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.buses[bus] = struct{}{}
+	return bus
+}
+
+type hubBus struct {
+	hub     *Hub
+	mutex   sync.RWMutex
+	handler func(envelope *Envelope)
+}
+
+func (b *hubBus) Publish(envelope *Envelope) error {
+	b.hub.mutex.RLock()
+	defer b.hub.mutex.RUnlock()
+
+	for bus := range b.hub.buses {
+		if bus != b {
+			bus.deliver(envelope)
+		}
+	}
+	return nil
+}
+
+func (b *hubBus) Subscribe(handler func(envelope *Envelope)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handler = handler
+}
+
+func (b *hubBus) Close() error {
+	b.hub.mutex.Lock()
+	defer b.hub.mutex.Unlock()
+	delete(b.hub.buses, b)
+	return nil
+}
+
+func (b *hubBus) deliver(envelope *Envelope) {
+	b.mutex.RLock()
+	handler := b.handler
+	b.mutex.RUnlock()
+
+	if nil != handler {
+		handler(envelope)
+	}
+}
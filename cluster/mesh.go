@@ -0,0 +1,370 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// the limit of the relayed envelope
+	maxEnvelopeSize = 64 << 20
+	// the timeouts of dialing, handshaking and writing a peer
+	meshDialTimeout      = time.Second
+	meshHandshakeTimeout = 5 * time.Second
+	meshWriteTimeout     = 5 * time.Second
+	// the size of the handshake challenge
+	meshNonceSize = 32
+)
+
+// Mesh relays the nodes over TCP connections, every node listens on an address and dials
+// the addresses of all the other nodes. The envelopes are sent on the dialed connections and
+// received on the accepted connections, the envelopes to a disconnected peer are dropped.
+type Mesh struct {
+	listener  net.Listener
+	secret    []byte
+	mutex     sync.RWMutex
+	handler   func(envelope *Envelope)
+	peers     []*meshPeer
+	closed    chan struct{}
+	wg        sync.WaitGroup
+	connMutex sync.Mutex
+	conns     map[net.Conn]struct{} // the accepted connections, nil after closed
+}
+
+// NewMesh listens on the address and dials the peers, the peers are redialed on failure.
+// The connections are not authenticated, the address must only be reachable by the nodes,
+// see NewAuthMesh.
+func NewMesh(addr string, peers ...string) (*Mesh, error) {
+	return NewAuthMesh(addr, nil, peers...)
+}
+
+// NewAuthMesh create a mesh authenticating the connections with the shared secret,
+// the accepting node challenges the dialing node with a random nonce which is answered
+// with the HMAC-SHA256 of the secret. The connections are not encrypted.
+func NewAuthMesh(addr string, secret []byte, peers ...string) (*Mesh, error) {
+	listener, err := net.Listen("tcp", addr)
+	if nil != err {
+		return nil, err
+	}
+
+	m := &Mesh{listener: listener, secret: secret, closed: make(chan struct{}), conns: make(map[net.Conn]struct{})}
+	for _, peer := range peers {
+		m.peers = append(m.peers, &meshPeer{mesh: m, addr: peer})
+	}
+
+	m.wg.Add(1)
+	go m.accept()
+	return m, nil
+}
+
+// Addr returns the listening address.
+func (m *Mesh) Addr() net.Addr {
+	return m.listener.Addr()
+}
+
+// Publish sends the envelope to the peers.
+func (m *Mesh) Publish(envelope *Envelope) error {
+	data := marshalEnvelope(envelope)
+	var errs []error
+	for _, peer := range m.peers {
+		if err := peer.send(data); nil != err {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe sets the handler of the envelopes from the peers.
+func (m *Mesh) Subscribe(handler func(envelope *Envelope)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.handler = handler
+}
+
+// Close stops listening and closes the connections.
+func (m *Mesh) Close() error {
+	m.connMutex.Lock()
+	select {
+	case <-m.closed:
+		m.connMutex.Unlock()
+		return nil
+	default:
+		close(m.closed)
+	}
+	conns := m.conns
+	m.conns = nil
+	m.connMutex.Unlock()
+
+	err := m.listener.Close()
+	for conn := range conns {
+		_ = conn.Close()
+	}
+	for _, peer := range m.peers {
+		peer.close()
+	}
+	m.wg.Wait()
+	return err
+}
+
+func (m *Mesh) accept() {
+	defer m.wg.Done()
+	for {
+		conn, err := m.listener.Accept()
+		if nil != err {
+			return
+		}
+
+		// the connection accepted after closed is never tracked
+		m.connMutex.Lock()
+		if nil == m.conns {
+			m.connMutex.Unlock()
+			_ = conn.Close()
+			return
+		}
+		m.conns[conn] = struct{}{}
+		m.wg.Add(1)
+		m.connMutex.Unlock()
+
+		go m.receive(conn)
+	}
+}
+
+// receive delivers the envelopes of the accepted connection.
+func (m *Mesh) receive(conn net.Conn) {
+	defer m.wg.Done()
+	defer func() {
+		m.connMutex.Lock()
+		delete(m.conns, conn)
+		m.connMutex.Unlock()
+	}()
+	defer conn.Close()
+
+	if nil != m.secret && nil != challenge(conn, m.secret) {
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		envelope, err := readEnvelope(reader)
+		if nil != err {
+			return
+		}
+
+		m.mutex.RLock()
+		handler := m.handler
+		m.mutex.RUnlock()
+		if nil != handler {
+			handler(envelope)
+		}
+	}
+}
+
+// challenge authenticates the accepted connection with a random nonce.
+func challenge(conn net.Conn, secret []byte) error {
+	_ = conn.SetDeadline(time.Now().Add(meshHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	nonce := make([]byte, meshNonceSize)
+	if _, err := rand.Read(nonce); nil != err {
+		return err
+	}
+	if _, err := conn.Write(nonce); nil != err {
+		return err
+	}
+
+	answer := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, answer); nil != err {
+		return err
+	}
+	if !hmac.Equal(answer, sign(secret, nonce)) {
+		return errors.New("cluster: peer authentication failed")
+	}
+	return nil
+}
+
+// answer answers the challenge of the dialed connection.
+func answer(conn net.Conn, secret []byte) error {
+	_ = conn.SetDeadline(time.Now().Add(meshHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	nonce := make([]byte, meshNonceSize)
+	if _, err := io.ReadFull(conn, nonce); nil != err {
+		return err
+	}
+	_, err := conn.Write(sign(secret, nonce))
+	return err
+}
+
+// sign returns the HMAC-SHA256 of the nonce with the secret.
+func sign(secret, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// meshPeer is the dialed connection of a peer.
+type meshPeer struct {
+	mesh    *Mesh
+	addr    string
+	mutex   sync.Mutex
+	conn    net.Conn
+	dialing bool
+	retryAt time.Time
+}
+
+// send writes the envelope with a write deadline, the connection is dialed outside the lock
+// if not connected, the dial is retried after a second if failed.
+func (p *meshPeer) send(data []byte) error {
+	conn, err := p.connect()
+	if nil != err {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// closed by a failed write of another sender
+	if conn != p.conn {
+		return errors.New("cluster: peer " + p.addr + " disconnected")
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(meshWriteTimeout))
+	if _, err := conn.Write(data); nil != err {
+		_ = conn.Close()
+		p.conn = nil
+		return err
+	}
+	return nil
+}
+
+// connect returns the connection of the peer, dials if not connected.
+func (p *meshPeer) connect() (net.Conn, error) {
+	p.mutex.Lock()
+	select {
+	case <-p.mesh.closed:
+		p.mutex.Unlock()
+		return nil, net.ErrClosed
+	default:
+	}
+
+	if conn := p.conn; nil != conn {
+		p.mutex.Unlock()
+		return conn, nil
+	}
+
+	if p.dialing || time.Now().Before(p.retryAt) {
+		p.mutex.Unlock()
+		return nil, errors.New("cluster: peer " + p.addr + " unavailable")
+	}
+	p.dialing = true
+	p.mutex.Unlock()
+
+	conn, err := net.DialTimeout("tcp", p.addr, meshDialTimeout)
+	if nil == err && nil != p.mesh.secret {
+		if err = answer(conn, p.mesh.secret); nil != err {
+			_ = conn.Close()
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.dialing = false
+
+	if nil != err {
+		p.retryAt = time.Now().Add(time.Second)
+		return nil, err
+	}
+
+	select {
+	case <-p.mesh.closed:
+		_ = conn.Close()
+		return nil, net.ErrClosed
+	default:
+	}
+	p.conn = conn
+	return conn, nil
+}
+
+func (p *meshPeer) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if nil != p.conn {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+}
+
+// marshalEnvelope encodes the envelope with the length prefix:
+//
+//	uint32 length | kind | uvarint len(node) | node | uvarint len(target) | target | data
+func marshalEnvelope(envelope *Envelope) []byte {
+	data := make([]byte, 4, 4+1+2*binary.MaxVarintLen64+len(envelope.Node)+len(envelope.Target)+len(envelope.Data))
+	data = append(data, byte(envelope.Kind))
+	data = binary.AppendUvarint(data, uint64(len(envelope.Node)))
+	data = append(data, envelope.Node...)
+	data = binary.AppendUvarint(data, uint64(len(envelope.Target)))
+	data = append(data, envelope.Target...)
+	data = append(data, envelope.Data...)
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
+	return data
+}
+
+// readEnvelope decodes the envelope of marshalEnvelope.
+func readEnvelope(reader *bufio.Reader) (*Envelope, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(reader, size[:]); nil != err {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(size[:])
+	if length > maxEnvelopeSize {
+		return nil, errors.New("cluster: envelope too large")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); nil != err {
+		return nil, err
+	}
+
+	errBad := errors.New("cluster: bad envelope")
+	if 0 == len(data) {
+		return nil, errBad
+	}
+
+	envelope := &Envelope{Kind: int(data[0])}
+	data = data[1:]
+	for _, field := range []*string{&envelope.Node, &envelope.Target} {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < n {
+			return nil, errBad
+		}
+		*field = string(data[size : size+int(n)])
+		data = data[size+int(n):]
+	}
+	envelope.Data = data
+	return envelope, nil
+}
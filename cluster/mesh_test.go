@@ -0,0 +1,110 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvelope(t *testing.T) {
+	var cases = []*Envelope{
+		{Kind: KindBroadcast, Node: "a", Data: []byte("hello")},
+		{Kind: KindConn, Node: "a", Target: "a/1", Data: []byte{}},
+		{Kind: KindUser, Node: "", Target: "user", Data: []byte{0, 1, 2}},
+	}
+
+	for _, c := range cases {
+		got, err := readEnvelope(bufio.NewReader(bytes.NewReader(marshalEnvelope(c))))
+		if nil != err {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c, got) {
+			t.Fatalf("envelope: %+v, want %+v", got, c)
+		}
+	}
+
+	if _, err := readEnvelope(bufio.NewReader(bytes.NewReader([]byte{0, 0, 0, 2, 0, 9}))); nil == err {
+		t.Fatal("bad envelope accepted")
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	var cases = []struct {
+		secret string
+		answer string
+		ok     bool
+	}{
+		{"secret", "secret", true},
+		{"secret", "guess", false},
+	}
+
+	for _, c := range cases {
+		server, client := net.Pipe()
+		go answer(client, []byte(c.answer))
+		err := challenge(server, []byte(c.secret))
+		if c.ok != (nil == err) {
+			t.Fatalf("secret %q answered by %q: %v", c.secret, c.answer, err)
+		}
+		server.Close()
+		client.Close()
+	}
+}
+
+func TestAuthMesh(t *testing.T) {
+	secret := []byte("secret")
+	a, err := NewAuthMesh("127.0.0.1:0", secret)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	received := make(chan *Envelope, 1)
+	a.Subscribe(func(envelope *Envelope) { received <- envelope })
+
+	b, err := NewAuthMesh("127.0.0.1:0", secret, a.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	sent := &Envelope{Kind: KindBroadcast, Node: "b", Data: []byte("hello")}
+	if err := b.Publish(sent); nil != err {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-received:
+		if !reflect.DeepEqual(sent, got) {
+			t.Fatalf("envelope: %+v, want %+v", got, sent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("envelope not received")
+	}
+
+	// a closed mesh is never redialed
+	if err := b.Close(); nil != err {
+		t.Fatal(err)
+	}
+	if err := b.Publish(sent); nil == err {
+		t.Fatal("published after closed")
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// Node binds the connections of a Websocket to the Bus.
+type Node struct {
+	id    string
+	bus   Bus
+	mutex sync.RWMutex
+	conns map[int64]nettyws.Conn
+	users map[string]map[nettyws.Conn]struct{}
+	keys  map[nettyws.Conn]string
+}
+
+// NewNode create the node of id bound to the Websocket and Bus, the connections are tracked by
+// the callbacks of Websocket.UseOpen and Websocket.UseClose. The id must be unique in the cluster
+// and without "/", NewNode must be called before Listen, Open or UpgradeHTTP.
+func NewNode(id string, ws *nettyws.Websocket, bus Bus) *Node {
+	n := &Node{
+		id:    id,
+		bus:   bus,
+		conns: make(map[int64]nettyws.Conn),
+		users: make(map[string]map[nettyws.Conn]struct{}),
+		keys:  make(map[nettyws.Conn]string),
+	}
+
+	ws.UseOpen(n.add)
+	ws.UseClose(func(conn nettyws.Conn, _ error) {
+		n.remove(conn)
+	})
+
+	bus.Subscribe(n.deliver)
+	return n
+}
+
+// ID returns the id of the node.
+func (n *Node) ID() string {
+	return n.id
+}
+
+// ConnID returns the cluster id of the local connection.
+func (n *Node) ConnID(conn nettyws.Conn) string {
+	return n.id + "/" + strconv.FormatInt(conn.ID(), 10)
+}
+
+// SetUser sets the user key of the local connection, a user may have connections on several nodes.
+// The connection is unwrapped from the middlewares, see nettyws.Unwrap.
+func (n *Node) SetUser(conn nettyws.Conn, user string) {
+	conn = nettyws.Unwrap(conn)
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.unsetUser(conn)
+	conns, ok := n.users[user]
+	if !ok {
+		conns = make(map[nettyws.Conn]struct{})
+		n.users[user] = conns
+	}
+	conns[conn] = struct{}{}
+	n.keys[conn] = user
+}
+
+// Broadcast sends the data to all the connections of the cluster.
+func (n *Node) Broadcast(data []byte) error {
+	n.deliverLocal(&Envelope{Kind: KindBroadcast, Data: data})
+	return n.bus.Publish(&Envelope{Kind: KindBroadcast, Node: n.id, Data: data})
+}
+
+// SendToConn sends the data to the connection of the cluster id.
+func (n *Node) SendToConn(connID string, data []byte) error {
+	envelope := &Envelope{Kind: KindConn, Node: n.id, Target: connID, Data: data}
+	if node, _, _ := strings.Cut(connID, "/"); node == n.id {
+		n.deliverLocal(envelope)
+		return nil
+	}
+	return n.bus.Publish(envelope)
+}
+
+// SendToUser sends the data to all the connections of the user in the cluster.
+func (n *Node) SendToUser(user string, data []byte) error {
+	envelope := &Envelope{Kind: KindUser, Node: n.id, Target: user, Data: data}
+	n.deliverLocal(envelope)
+	return n.bus.Publish(envelope)
+}
+
+// deliver delivers the envelopes from the other nodes.
+func (n *Node) deliver(envelope *Envelope) {
+	if envelope.Node != n.id {
+		n.deliverLocal(envelope)
+	}
+}
+
+// deliverLocal writes the data to the local connections of the envelope.
+func (n *Node) deliverLocal(envelope *Envelope) {
+	var targets []nettyws.Conn
+
+	n.mutex.RLock()
+	switch envelope.Kind {
+	case KindBroadcast:
+		targets = make([]nettyws.Conn, 0, len(n.conns))
+		for _, conn := range n.conns {
+			targets = append(targets, conn)
+		}
+	case KindConn:
+		node, id, _ := strings.Cut(envelope.Target, "/")
+		if connID, err := strconv.ParseInt(id, 10, 64); nil == err && node == n.id {
+			if conn, ok := n.conns[connID]; ok {
+				targets = append(targets, conn)
+			}
+		}
+	case KindUser:
+		for conn := range n.users[envelope.Target] {
+			targets = append(targets, conn)
+		}
+	}
+	n.mutex.RUnlock()
+
+	for _, conn := range targets {
+		_ = conn.Write(envelope.Data)
+	}
+}
+
+// add tracks the opened connection.
+func (n *Node) add(conn nettyws.Conn) {
+	n.mutex.Lock()
+	n.conns[conn.ID()] = conn
+	n.mutex.Unlock()
+
+	// the user key resolved by nettyws.WithUserKey
+	if user := conn.UserKey(); "" != user {
+		n.SetUser(conn, user)
+	}
+}
+
+// remove removes the closed connection.
+func (n *Node) remove(conn nettyws.Conn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	delete(n.conns, conn.ID())
+	n.unsetUser(conn)
+}
+
+// unsetUser removes the user key of the connection.
+func (n *Node) unsetUser(conn nettyws.Conn) {
+	if user, ok := n.keys[conn]; ok {
+		delete(n.keys, conn)
+		if conns := n.users[user]; nil != conns {
+			delete(conns, conn)
+			if 0 == len(conns) {
+				delete(n.users, user)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"net/http"
+	"testing"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+func TestNode(t *testing.T) {
+	hub := NewHub()
+	wsA := nettyws.NewWebsocket()
+	nodeA := NewNode("a", wsA, hub.Join())
+	wsB := nettyws.NewWebsocket(nettyws.WithUserKey(func(request *http.Request) (string, error) {
+		return request.URL.Query().Get("user"), nil
+	}))
+	nodeB := NewNode("b", wsB, hub.Join())
+
+	// the callbacks of the application never replace the tracking of the node
+	opened, closed := make(chan string, 1), make(chan string, 1)
+	wsB.OnOpen = func(conn nettyws.Conn) {
+		opened <- nodeB.ConnID(conn)
+	}
+	wsB.OnClose = func(conn nettyws.Conn, err error) {
+		closed <- nodeB.ConnID(conn)
+	}
+
+	received := make(chan string, 1)
+	client := nettyws.NewWebsocket()
+	client.OnData = func(conn nettyws.Conn, data []byte) {
+		received <- string(data)
+	}
+	conn := wstest.Open(t, client, wstest.Serve(t, wsB)+"?user=alice")
+	connID := wstest.Receive(t, opened)
+
+	var cases = []struct {
+		name string
+		send func() error
+	}{
+		{name: "broadcast", send: func() error { return nodeA.Broadcast([]byte("broadcast")) }},
+		{name: "conn", send: func() error { return nodeA.SendToConn(connID, []byte("conn")) }},
+		{name: "user", send: func() error { return nodeA.SendToUser("alice", []byte("user")) }},
+	}
+
+	for _, c := range cases {
+		if err := c.send(); nil != err {
+			t.Fatal(err)
+		}
+		if data := wstest.Receive(t, received); c.name != data {
+			t.Fatalf("received %q, want %q", data, c.name)
+		}
+	}
+
+	// the closed connection is removed from the node
+	_ = conn.Close()
+	if id := wstest.Receive(t, closed); connID != id {
+		t.Fatalf("closed %s, want %s", id, connID)
+	}
+	nodeB.mutex.RLock()
+	defer nodeB.mutex.RUnlock()
+	if 0 != len(nodeB.conns) || 0 != len(nodeB.users) || 0 != len(nodeB.keys) {
+		t.Fatal("the closed connection is not removed")
+	}
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command nettyws-tunnel forwards TCP connections over websocket connections.
+//
+// The client mode listens on a local TCP address and forwards every accepted connection
+// over a new websocket connection:
+//
+//	nettyws-tunnel -mode client -listen 127.0.0.1:2222 -url wss://example.com/tunnel -header "Authorization: Bearer secret"
+//
+// The server mode accepts the websocket connections and forwards them to the upstream:
+//
+//	nettyws-tunnel -mode server -listen wss://0.0.0.0:443/tunnel -cert cert.pem -key key.pem -upstream 127.0.0.1:22 -token secret
+//
+// The websocket connections have no half-close, the tunnel is closed when the tcp peer stops writing.
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// headers is the repeatable header flag.
+type headers http.Header
+
+func (h headers) String() string {
+	return fmt.Sprint(http.Header(h))
+}
+
+func (h headers) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return errors.New("header must be \"Name: value\"")
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(val))
+	return nil
+}
+
+func main() {
+	var (
+		mode     = flag.String("mode", "client", "client or server")
+		listen   = flag.String("listen", "", "client: local tcp address, server: websocket url, e.g. ws://0.0.0.0:8080/tunnel")
+		url      = flag.String("url", "", "client: websocket url of the server, ws:// or wss://")
+		upstream = flag.String("upstream", "", "server: tcp address of the upstream")
+		token    = flag.String("token", "", "server: required bearer token of the Authorization header")
+		cert     = flag.String("cert", "", "server: tls certificate file of wss://")
+		key      = flag.String("key", "", "server: tls key file of wss://")
+		insecure = flag.Bool("insecure", false, "client: skip the tls verification of wss://")
+		compress = flag.Int("compress", 0, "compression level of permessage-deflate, 0 disables compression")
+		timeout  = flag.Duration("timeout", 10*time.Second, "dial timeout")
+		header   = headers{}
+	)
+	flag.Var(header, "header", "client: handshake request header \"Name: value\", repeatable")
+	flag.Parse()
+
+	options := []nettyws.Option{nettyws.WithDialTimeout(*timeout)}
+	if *compress > 0 {
+		options = append(options, nettyws.WithCompress(*compress, 512))
+	}
+
+	var err error
+	switch *mode {
+	case "client":
+		err = runClient(*listen, *url, header, *insecure, options)
+	case "server":
+		err = runServer(*listen, *upstream, *token, *cert, *key, *timeout, options)
+	default:
+		err = fmt.Errorf("unknown mode: %s", *mode)
+	}
+
+	if nil != err {
+		fmt.Fprintln(os.Stderr, "nettyws-tunnel:", err)
+		os.Exit(1)
+	}
+}
+
+// runClient forwards the local tcp connections over new websocket connections.
+func runClient(listen, url string, header headers, insecure bool, options []nettyws.Option) error {
+	if "" == listen || "" == url {
+		return errors.New("client mode requires -listen and -url")
+	}
+
+	if len(header) > 0 {
+		options = append(options, nettyws.WithClientHeader(http.Header(header)))
+	}
+	if insecure {
+		options = append(options, nettyws.WithClientTLS(&tls.Config{InsecureSkipVerify: true}))
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if nil != err {
+		return err
+	}
+	log.Printf("forwarding %s to %s", listener.Addr(), url)
+	return serveClient(listener, url, options)
+}
+
+// serveClient accepts the tcp connections of the listener and forwards them over new websocket connections
+// until the listener is closed.
+func serveClient(listener net.Listener, url string, options []nettyws.Option) error {
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if nil != err {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// retry the temporary errors like too many open files with backoff
+			delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+			log.Printf("accept: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		go func() {
+			tunnel, err := nettyws.DialNetConn(context.Background(), url, options...)
+			if nil != err {
+				log.Printf("open %s: %v", url, err)
+				_ = conn.Close()
+				return
+			}
+			pipe(conn, tunnel)
+		}()
+	}
+}
+
+// runServer forwards the websocket connections to the upstream.
+func runServer(listen, upstream, token, cert, key string, timeout time.Duration, options []nettyws.Option) error {
+	if "" == listen || "" == upstream {
+		return errors.New("server mode requires -listen and -upstream")
+	}
+
+	if ("" == cert) != ("" == key) {
+		return errors.New("-cert and -key are required together")
+	}
+	if secure := strings.HasPrefix(listen, "wss://"); secure != ("" != cert) {
+		return errors.New("wss:// requires -cert and -key, ws:// does not accept them")
+	}
+	if "" != cert {
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if nil != err {
+			return err
+		}
+		options = append(options, nettyws.WithServeTLS(&tls.Config{Certificates: []tls.Certificate{certificate}}))
+	}
+
+	log.Printf("forwarding %s to %s", listen, upstream)
+	return newServer(upstream, token, timeout, options).Listen(listen)
+}
+
+// newServer returns the Websocket forwards the connections to the upstream,
+// the handshakes without the bearer token are rejected if the token is not empty.
+func newServer(upstream, token string, timeout time.Duration, options []nettyws.Option) *nettyws.Websocket {
+	// the handshake is authorized before upgrading
+	if "" != token {
+		options = append(options, nettyws.WithUserKey(authorize(token)))
+	}
+
+	ws := nettyws.NewWebsocket(append(options, nettyws.WithBinary(), nettyws.WithHandshakeTimeout(timeout))...)
+	ws.OnOpen = func(conn nettyws.Conn) {
+		tunnel, err := nettyws.NetConn(conn, nettyws.MsgBinary)
+		if nil != err {
+			log.Printf("tunnel: %v", err)
+			_ = conn.Close()
+			return
+		}
+		go func() {
+			upstreamConn, err := net.DialTimeout("tcp", upstream, timeout)
+			if nil != err {
+				log.Printf("dial %s: %v", upstream, err)
+				_ = tunnel.Close()
+				return
+			}
+			pipe(upstreamConn, tunnel)
+		}()
+	}
+	return ws
+}
+
+// authorize rejects the handshake without the bearer token, the token is compared in constant time.
+func authorize(token string) nettyws.UserKeyFunc {
+	expected := []byte("Bearer " + token)
+	return func(request *http.Request) (string, error) {
+		if 1 != subtle.ConstantTimeCompare(expected, []byte(request.Header.Get("Authorization"))) {
+			return "", nettyws.HandshakeError{Status: http.StatusUnauthorized, Reason: "unauthorized"}
+		}
+		return "", nil
+	}
+}
+
+// pipe copies the data between the connections until both directions end.
+// The end of one direction is propagated as a half-close if the destination supports CloseWrite,
+// like the tcp connections. The websocket connections have no half-close, so the end of the
+// direction to a websocket connection closes both connections.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		forward(a, b)
+	}()
+	go func() {
+		defer wg.Done()
+		forward(b, a)
+	}()
+	wg.Wait()
+
+	_ = a.Close()
+	_ = b.Close()
+}
+
+// forward copies src to dst, the other direction is stopped unless dst is half-closed.
+func forward(dst, src net.Conn) {
+	_, err := io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok && nil == err {
+		if nil == cw.CloseWrite() {
+			return
+		}
+	}
+	_ = dst.Close()
+	_ = src.Close()
+}
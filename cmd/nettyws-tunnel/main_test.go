@@ -0,0 +1,108 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// listenTest listens on a free loopback port, the listener is closed with the test.
+func listenTest(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	return listener
+}
+
+// echoTest serves the tcp echo upstream.
+func echoTest(t *testing.T) string {
+	listener := listenTest(t)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if nil != err {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestTunnel(t *testing.T) {
+	ws := newServer(echoTest(t), "secret", time.Second, nil)
+	server := httptest.NewServer(ws)
+	t.Cleanup(func() {
+		_ = ws.Close()
+		server.Close()
+	})
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	var cases = []struct {
+		token     string
+		forwarded bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+		{"", false},
+	}
+
+	for i, c := range cases {
+		header := http.Header{}
+		if "" != c.token {
+			header.Set("Authorization", "Bearer "+c.token)
+		}
+		listener := listenTest(t)
+		go func() { _ = serveClient(listener, url, []nettyws.Option{nettyws.WithClientHeader(header)}) }()
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if nil != err {
+			t.Fatal(err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		// the data spans many messages of the tunnel
+		data := make([]byte, 1<<20)
+		_, _ = rand.Read(data)
+		go func() { _, _ = conn.Write(data) }()
+
+		echo, err := io.ReadAll(io.LimitReader(conn, int64(len(data))))
+		_ = conn.Close()
+		if c.forwarded != bytes.Equal(data, echo) {
+			t.Fatalf("case %d: echoed %d bytes: %v", i, len(echo), err)
+		}
+		if !c.forwarded && 0 != len(echo) {
+			t.Fatalf("case %d: unauthorized tunnel echoed %d bytes", i, len(echo))
+		}
+	}
+}
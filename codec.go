@@ -0,0 +1,99 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Codec encodes and decodes the values of messages, the codec/msgpack and
+// codec/protobuf packages provide the MessagePack and Protobuf codecs.
+type Codec interface {
+	// Marshal returns the encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes the data to v.
+	Unmarshal(data []byte, v interface{}) error
+	// MessageType returns the message type of the encoded messages.
+	MessageType() MessageType
+}
+
+// JSON is the default codec of text messages.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) MessageType() MessageType {
+	return MsgText
+}
+
+// WriteValue encodes v with the codec of the connection and writes the message.
+func WriteValue(conn Conn, v interface{}) error {
+	data, err := conn.Codec().Marshal(v)
+	if nil != err {
+		return err
+	}
+	return conn.Write(data)
+}
+
+// ReadValue decodes the message to v with the codec of the connection.
+func ReadValue(conn Conn, data []byte, v interface{}) error {
+	return conn.Codec().Unmarshal(data, v)
+}
+
+// WriteJSON encodes v as JSON and writes the message.
+func WriteJSON(conn Conn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if nil != err {
+		return err
+	}
+	return conn.Write(data)
+}
+
+// ReadJSON decodes the JSON message to v.
+func ReadJSON(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// OnMessage returns an OnDataFunc decodes the messages to T with the codec of the connection,
+// the connection is closed with 1007 if the message cannot be decoded. A new value is allocated
+// for pointer types, e.g. the generated *Message of protobuf.
+func OnMessage[T any](handler func(conn Conn, message T)) OnDataFunc {
+	typ := reflect.TypeFor[T]()
+	return func(conn Conn, data []byte) {
+		var message T
+		var v interface{} = &message
+		if reflect.Pointer == typ.Kind() {
+			message = reflect.New(typ.Elem()).Interface().(T)
+			v = message
+		}
+		if err := conn.Codec().Unmarshal(data, v); nil != err {
+			_ = conn.WriteClose(1007, "invalid message")
+			_ = conn.Close()
+			return
+		}
+		handler(conn, message)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package msgpack implements the MessagePack nettyws.Codec of binary messages.
+package msgpack
+
+import (
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type codec struct{}
+
+// New create the MessagePack codec, use with nettyws.WithCodec.
+func New() nettyws.Codec {
+	return codec{}
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+func (codec) MessageType() nettyws.MessageType {
+	return nettyws.MsgBinary
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package msgpack
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+type message struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestCodec(t *testing.T) {
+	codec := New()
+	if nettyws.MsgBinary != codec.MessageType() {
+		t.Fatalf("message type %v, want binary", codec.MessageType())
+	}
+
+	want := message{Name: "hello", Count: 1, Tags: []string{"a", "b"}}
+	data, err := codec.Marshal(want)
+	if nil != err {
+		t.Fatal(err)
+	}
+	var got message
+	if err := codec.Unmarshal(data, &got); nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("decoded %#v, want %#v", got, want)
+	}
+}
+
+func TestOnMessage(t *testing.T) {
+	received := make(chan *message, 1)
+	server := nettyws.NewWebsocket(nettyws.WithCodec(New()))
+	server.OnData = nettyws.OnMessage(func(conn nettyws.Conn, msg *message) {
+		received <- msg
+	})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Close()
+
+	client := nettyws.NewWebsocket(nettyws.WithCodec(New()))
+	defer client.Close()
+	conn, err := client.Open("ws" + strings.TrimPrefix(httpServer.URL, "http"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	want := &message{Name: "hello", Count: 2, Tags: []string{"c"}}
+	if err := nettyws.WriteValue(conn, want); nil != err {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("received %#v, want %#v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
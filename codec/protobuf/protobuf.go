@@ -0,0 +1,53 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package protobuf implements the Protobuf nettyws.Codec of binary messages,
+// the values must be proto.Message.
+package protobuf
+
+import (
+	"fmt"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"google.golang.org/protobuf/proto"
+)
+
+type codec struct{}
+
+// New create the Protobuf codec, use with nettyws.WithCodec.
+func New() nettyws.Codec {
+	return codec{}
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf: %T is not proto.Message", v)
+	}
+	return proto.Marshal(message)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+func (codec) MessageType() nettyws.MessageType {
+	return nettyws.MsgBinary
+}
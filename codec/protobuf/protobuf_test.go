@@ -0,0 +1,92 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package protobuf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	codec := New()
+	if nettyws.MsgBinary != codec.MessageType() {
+		t.Fatalf("message type %v, want binary", codec.MessageType())
+	}
+
+	want, err := structpb.NewStruct(map[string]interface{}{"name": "hello", "count": 1})
+	if nil != err {
+		t.Fatal(err)
+	}
+	data, err := codec.Marshal(want)
+	if nil != err {
+		t.Fatal(err)
+	}
+	got := &structpb.Struct{}
+	if err := codec.Unmarshal(data, got); nil != err {
+		t.Fatal(err)
+	}
+	if !proto.Equal(want, got) {
+		t.Fatalf("decoded %v, want %v", got, want)
+	}
+
+	// the values must be proto.Message
+	if _, err := codec.Marshal("hello"); nil == err {
+		t.Fatal("marshal string without error")
+	}
+	var value string
+	if err := codec.Unmarshal(data, &value); nil == err {
+		t.Fatal("unmarshal string without error")
+	}
+}
+
+func TestOnMessage(t *testing.T) {
+	received := make(chan *wrapperspb.StringValue, 1)
+	server := nettyws.NewWebsocket(nettyws.WithCodec(New()))
+	server.OnData = nettyws.OnMessage(func(conn nettyws.Conn, message *wrapperspb.StringValue) {
+		received <- message
+	})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Close()
+
+	client := nettyws.NewWebsocket(nettyws.WithCodec(New()))
+	defer client.Close()
+	conn, err := client.Open("ws" + strings.TrimPrefix(httpServer.URL, "http"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	want := wrapperspb.String("hello")
+	if err := nettyws.WriteValue(conn, want); nil != err {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if !proto.Equal(want, got) {
+			t.Fatalf("received %v, want %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type codecMessage struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// pointerCodec decodes only to *codecMessage like the protobuf codec to proto.Message.
+type pointerCodec struct{}
+
+func (pointerCodec) Marshal(v interface{}) ([]byte, error) {
+	return JSON.Marshal(v)
+}
+
+func (pointerCodec) Unmarshal(data []byte, v interface{}) error {
+	if _, ok := v.(*codecMessage); !ok {
+		return fmt.Errorf("%T is not *codecMessage", v)
+	}
+	return JSON.Unmarshal(data, v)
+}
+
+func (pointerCodec) MessageType() MessageType {
+	return MsgBinary
+}
+
+func TestOnMessage(t *testing.T) {
+	var cases = []struct {
+		name    string
+		codec   Codec
+		onData  func(received chan<- interface{}) OnDataFunc
+		message interface{}
+		want    interface{}
+	}{
+		{
+			name:  "value",
+			codec: JSON,
+			onData: func(received chan<- interface{}) OnDataFunc {
+				return OnMessage(func(conn Conn, message codecMessage) { received <- message })
+			},
+			message: codecMessage{Name: "hello", Count: 1},
+			want:    codecMessage{Name: "hello", Count: 1},
+		},
+		{
+			name:  "pointer",
+			codec: JSON,
+			onData: func(received chan<- interface{}) OnDataFunc {
+				return OnMessage(func(conn Conn, message *codecMessage) { received <- message })
+			},
+			message: codecMessage{Name: "hello", Count: 2},
+			want:    &codecMessage{Name: "hello", Count: 2},
+		},
+		{
+			name:  "pointer codec",
+			codec: pointerCodec{},
+			onData: func(received chan<- interface{}) OnDataFunc {
+				return OnMessage(func(conn Conn, message *codecMessage) { received <- message })
+			},
+			message: &codecMessage{Name: "world", Count: 3},
+			want:    &codecMessage{Name: "world", Count: 3},
+		},
+		{
+			name:  "interface",
+			codec: JSON,
+			onData: func(received chan<- interface{}) OnDataFunc {
+				return OnMessage(func(conn Conn, message interface{}) { received <- message })
+			},
+			message: []string{"hello"},
+			want:    []interface{}{"hello"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			received := make(chan interface{}, 1)
+			server := NewWebsocket(WithCodec(c.codec))
+			server.OnData = c.onData(received)
+
+			conn := openTest(t, NewWebsocket(WithCodec(c.codec)), serveTest(t, server))
+			if err := WriteValue(conn, c.message); nil != err {
+				t.Fatal(err)
+			}
+			if message := receiveTest(t, received); !reflect.DeepEqual(c.want, message) {
+				t.Fatalf("received %#v, want %#v", message, c.want)
+			}
+		})
+	}
+}
+
+func TestOnMessageInvalid(t *testing.T) {
+	server := NewWebsocket()
+	server.OnData = OnMessage(func(conn Conn, message codecMessage) {
+		t.Error("invalid message is handled")
+	})
+
+	closed := make(chan error, 1)
+	client := NewWebsocket()
+	client.OnClose = func(conn Conn, err error) {
+		closed <- err
+	}
+
+	conn := openTest(t, client, serveTest(t, server))
+	if err := conn.Write([]byte("{")); nil != err {
+		t.Fatal(err)
+	}
+
+	var closedErr ClosedError
+	if err := receiveTest(t, closed); !errors.As(err, &closedErr) || 1007 != closedErr.Code {
+		t.Fatalf("closed with %v, want 1007", err)
+	}
+}
+
+func TestWithCodecNil(t *testing.T) {
+	ws := NewWebsocket(WithCodec(nil))
+	if _, err := ws.Open("ws://127.0.0.1:1/"); nil == err || "nettyws: nil codec" != err.Error() {
+		t.Fatalf("open returns %v", err)
+	}
+	if err := ws.Listen("ws://127.0.0.1:0/"); nil == err || "nettyws: nil codec" != err.Error() {
+		t.Fatalf("listen returns %v", err)
+	}
+}
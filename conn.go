@@ -19,6 +19,7 @@ package nettyws
 import (
 	"bytes"
 	"context"
+	"log/slog"
 	"net/http"
 	"sync/atomic"
 	"time"
@@ -30,6 +31,8 @@ import (
 
 // Conn is a websocket connection.
 type Conn interface {
+	// ID returns the id of the connection, unique in the engine.
+	ID() int64
 	// Context returns the context of the connection.
 	Context() context.Context
 	// LocalAddr returns the local network address.
@@ -40,6 +43,8 @@ type Conn interface {
 	Header() http.Header
 	// Request returns the HTTP handshake request.
 	Request() *http.Request
+	// UserKey returns the user key of the server connection, see WithUserKey.
+	UserKey() string
 	// SetDeadline sets the read and write deadlines associated
 	// with the connection. It is equivalent to calling both
 	// SetReadDeadline and SetWriteDeadline.
@@ -56,6 +61,12 @@ type Conn interface {
 	SetWriteDeadline(t time.Time) error
 	// Write writes a message to the connection.
 	Write(message []byte) error
+	// Buffered returns the number of messages and bytes queued by async write.
+	Buffered() (messages int, bytes int)
+	// Stats returns the statistics of the connection.
+	Stats() Stats
+	// Codec returns the codec of the messages.
+	Codec() Codec
 	// WriteClose write websocket close frame with code and close reason.
 	WriteClose(code int, reason string) error
 	// Close closes the connection.
@@ -75,21 +86,101 @@ type wsh interface {
 	Request() *http.Request
 }
 
+// Stats is the statistics of a connection, the frame level statistics
+// are only available with the WithFrameStats option.
+type Stats struct {
+	// ConnectedAt is the time the connection was established.
+	ConnectedAt time.Time
+	// LastRead is the time of the last received message.
+	LastRead time.Time
+	// LastWrite is the time of the last sent message.
+	LastWrite time.Time
+	// MessagesIn is the number of received messages.
+	MessagesIn int64
+	// MessagesOut is the number of sent messages.
+	MessagesOut int64
+	// BytesIn is the payload bytes of received messages.
+	BytesIn int64
+	// BytesOut is the payload bytes of sent messages.
+	BytesOut int64
+	// FramesIn is the number of received frames, including control frames.
+	FramesIn int64
+	// FramesOut is the number of sent frames, including control frames.
+	FramesOut int64
+	// WireBytesIn is the payload bytes of received data frames, compressed if enabled.
+	WireBytesIn int64
+	// WireBytesOut is the payload bytes of sent data frames, compressed if enabled.
+	WireBytesOut int64
+	// PingRTT is the round trip time of the last ping answered by the peer.
+	PingRTT time.Duration
+}
+
+// CompressionRatio returns the ratio of the wire bytes to the message bytes,
+// zero returned if the frame level statistics is unavailable.
+func (s Stats) CompressionRatio() float64 {
+	if total := s.BytesIn + s.BytesOut; total > 0 {
+		return float64(s.WireBytesIn+s.WireBytesOut) / float64(total)
+	}
+	return 0
+}
+
 type wsConn struct {
-	ws       *Websocket
-	channel  netty.Channel
-	client   bool
-	userdata atomic.Value
+	ws          *Websocket
+	channel     netty.Channel
+	ctx         context.Context
+	client      bool
+	queue       *writeQueue
+	limiter     *rateLimiter
+	outbound    WriteHandler
+	wire        *wireConn
+	user        string
+	sink        atomic.Pointer[netConn]
+	connectedAt time.Time
+	lastRead    atomic.Int64
+	lastWrite   atomic.Int64
+	messagesIn  atomic.Int64
+	messagesOut atomic.Int64
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+	userdata    atomic.Value
+	session     atomic.Value // the *typedConn of TypedWebsocket
 }
 
 // newConn create a websocket connection.
 func newConn(ws *Websocket, channel netty.Channel, client bool) Conn {
-	return &wsConn{ws: ws, channel: channel, client: client}
+	conn := &wsConn{ws: ws, channel: channel, ctx: channel.Context(), client: client, connectedAt: time.Now()}
+	if nil != ws.tracer && !client {
+		conn.ctx = valueContext{Context: conn.ctx, values: conn.Request().Context()}
+	}
+	if !client {
+		conn.user = userOf(conn.Request())
+	}
+	if ws.wireEnabled() {
+		if client {
+			conn.wire = wireOf(channel.Context())
+		} else {
+			conn.wire = wireOf(conn.Request().Context())
+		}
+	}
+	conn.outbound = ws.outbound(conn)
+	conn.limiter = newRateLimiter(ws.opts.messageRate, ws.opts.byteRate, ws.opts.rateLimitAction)
+	if size := ws.opts.writeQueueSize; size > 0 {
+		conn.queue = newWriteQueue(channel, size, ws.opts.queuePolicy)
+		if nil != ws.opts.metrics {
+			conn.queue.depth = ws.addWriteQueueDepth
+		}
+	}
+	return conn
+}
+
+// ID returns the id of the connection, unique in the engine.
+func (c *wsConn) ID() int64 {
+	return c.channel.ID()
 }
 
 // Context returns the context of the connection.
 func (c *wsConn) Context() context.Context {
-	return c.channel.Context()
+	return c.ctx
 }
 
 // LocalAddr returns the local network address.
@@ -112,10 +203,18 @@ func (c *wsConn) Request() *http.Request {
 	return c.channel.Transport().(wsh).Request()
 }
 
+// UserKey returns the user key of the server connection, see WithUserKey.
+func (c *wsConn) UserKey() string {
+	return c.user
+}
+
 // SetDeadline sets the read and write deadlines associated
 // with the connection. It is equivalent to calling both
 // SetReadDeadline and SetWriteDeadline.
 func (c *wsConn) SetDeadline(t time.Time) error {
+	if nil != c.queue {
+		c.queue.setDeadline(t)
+	}
 	return c.channel.Transport().SetDeadline(t)
 }
 
@@ -131,14 +230,82 @@ func (c *wsConn) SetReadDeadline(t time.Time) error {
 // Even if write times out, it may return n > 0, indicating that
 // some of the data was successfully written.
 // A zero value for t means Write will not time out.
+// With the async write, Write returns os.ErrDeadlineExceeded after the deadline and the
+// blocked Write of QueueBlock policy times out, the write loop is bounded by the deadline too.
 func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	if nil != c.queue {
+		c.queue.setDeadline(t)
+	}
 	return c.channel.Transport().SetWriteDeadline(t)
 }
 
 // Write writes a message to the connection.
 func (c *wsConn) Write(message []byte) error {
-	_, err := c.channel.Write1(message)
-	return err
+	if nil != c.outbound {
+		return c.outbound(c, message)
+	}
+	return c.write(message)
+}
+
+// write writes a message after the write middlewares.
+func (c *wsConn) write(message []byte) (err error) {
+	if nil != c.queue {
+		err = c.queue.push(message, c.onSlowConsumer)
+	} else {
+		_, err = c.channel.Write1(message)
+	}
+
+	if nil != err {
+		c.ws.metrics.Error(err)
+		return err
+	}
+
+	c.messagesOut.Add(1)
+	c.bytesOut.Add(int64(len(message)))
+	c.lastWrite.Store(time.Now().UnixNano())
+	c.ws.metrics.MessageOut(len(message))
+	return nil
+}
+
+// Buffered returns the number of messages and bytes queued by async write.
+func (c *wsConn) Buffered() (messages int, bytes int) {
+	if nil != c.queue {
+		return c.queue.Buffered()
+	}
+	return 0, 0
+}
+
+// Stats returns the statistics of the connection.
+func (c *wsConn) Stats() Stats {
+	stats := Stats{
+		ConnectedAt: c.connectedAt,
+		MessagesIn:  c.messagesIn.Load(),
+		MessagesOut: c.messagesOut.Load(),
+		BytesIn:     c.bytesIn.Load(),
+		BytesOut:    c.bytesOut.Load(),
+	}
+
+	if lastRead := c.lastRead.Load(); lastRead > 0 {
+		stats.LastRead = time.Unix(0, lastRead)
+	}
+
+	if lastWrite := c.lastWrite.Load(); lastWrite > 0 {
+		stats.LastWrite = time.Unix(0, lastWrite)
+	}
+
+	if nil != c.wire {
+		stats.FramesIn = c.wire.stats.framesIn.Load()
+		stats.FramesOut = c.wire.stats.framesOut.Load()
+		stats.WireBytesIn = c.wire.stats.wireBytesIn.Load()
+		stats.WireBytesOut = c.wire.stats.wireBytesOut.Load()
+		stats.PingRTT = time.Duration(c.wire.stats.pingRTT.Load())
+	}
+	return stats
+}
+
+// Codec returns the codec of the messages.
+func (c *wsConn) Codec() Codec {
+	return c.ws.opts.codec
 }
 
 // WriteClose write websocket close frame with code and close reason.
@@ -148,6 +315,10 @@ func (c *wsConn) WriteClose(code int, reason string) error {
 
 // Close closes the connection.
 func (c *wsConn) Close() error {
+	// wait async send finished.
+	if nil != c.queue {
+		c.queue.wait()
+	}
 	c.channel.Close(nil)
 	return nil
 }
@@ -162,8 +333,52 @@ func (c *wsConn) SetUserdata(userdata interface{}) {
 	c.userdata.Store(userdata)
 }
 
+func (c *wsConn) onSlowConsumer() {
+	if onSlowConsumer := c.ws.OnSlowConsumer; nil != onSlowConsumer {
+		defer c.recoverCallback("OnSlowConsumer")
+		onSlowConsumer(c)
+	}
+}
+
+func (c *wsConn) onData(data []byte) {
+	// the messages are read by NetConn
+	if sink := c.sink.Load(); nil != sink {
+		sink.push(data)
+		return
+	}
+
+	handler := c.ws.inbound
+	if nil == handler {
+		if onData := c.ws.OnData; nil != onData {
+			handler = Handler(onData)
+		} else {
+			return
+		}
+	}
+
+	defer c.recoverCallback("OnData")
+
+	if nil != c.ws.tracer && c.ws.opts.traceMessages {
+		_, end := c.ws.tracer.Start(c.ctx, spanMessage, slog.Int("size", len(data)))
+		defer end(nil)
+	}
+	handler(c, data)
+}
+
 func (c *wsConn) HandleActive(ctx netty.ActiveContext) {
+	c.ws.metrics.ConnOpened(c.client)
+	c.log(slog.LevelDebug, "websocket connection opened", slog.Bool("client", c.client))
+	c.ws.joinUser(c)
+
+	for _, onOpen := range c.ws.openCallbacks {
+		func() {
+			defer c.recoverCallback("UseOpen")
+			onOpen(c)
+		}()
+	}
+
 	if onOpen := c.ws.OnOpen; nil != onOpen {
+		defer c.recoverCallback("OnOpen")
 		onOpen(c)
 		return
 	}
@@ -180,31 +395,71 @@ func (c *wsConn) HandleRead(ctx netty.InboundContext, message netty.Message) {
 
 		// read message to buffer
 		if _, err := buffer.ReadFrom(reader); nil != err {
+			c.logReadError(err)
 			// interrupted network read loop
 			panic(err)
 		}
 
-		// invoke OnData callback
-		if onData := c.ws.OnData; onData != nil {
-			onData(c, buffer.Bytes())
+		c.messagesIn.Add(1)
+		c.bytesIn.Add(int64(buffer.Len()))
+		c.lastRead.Store(time.Now().UnixNano())
+		c.ws.metrics.MessageIn(buffer.Len())
+
+		// apply inbound rate limit
+		if nil != c.limiter && !c.limiter.allow(buffer.Len()) {
+			if RateLimitClose == c.limiter.action {
+				closeErr := ClosedError{Code: 1008, Reason: "rate limit exceeded"}
+				_ = c.WriteClose(closeErr.Code, closeErr.Reason)
+				ctx.Close(closeErr)
+				return
+			}
+			continue
 		}
 
+		// invoke OnData callback
+		c.onData(buffer.Bytes())
+
 		// TODO: recreate large buffer for reduce memory usage
 		//
 	}
 }
 
 func (c *wsConn) HandleException(ctx netty.ExceptionContext, ex netty.Exception) {
+	c.ws.metrics.Error(ex)
 	ctx.Close(ex)
 }
 
 func (c *wsConn) HandleInactive(ctx netty.InactiveContext, ex netty.Exception) {
+	// release the server connection
+	if !c.client {
+		c.ws.releaseHandshake(c.Request())
+	}
+
 	// covert error
 	if closeErr, ok := ex.(wsutil.ClosedError); ok {
 		ex = ClosedError{Code: int(closeErr.Code), Reason: closeErr.Reason}
 	}
 
+	c.ws.leaveUser(c)
+	if sink := c.sink.Load(); nil != sink {
+		sink.closeRead(ex)
+	}
+	c.ws.metrics.ConnClosed(c.client, closeCode(ex))
+	c.logClose(ex)
+	if nil != c.wire {
+		stats := c.Stats()
+		c.ws.metrics.CompressionSaved(stats.BytesIn + stats.BytesOut - stats.WireBytesIn - stats.WireBytesOut)
+	}
+
+	for _, onClose := range c.ws.closeCallbacks {
+		func() {
+			defer c.recoverCloseCallback("UseClose")
+			onClose(c, ex)
+		}()
+	}
+
 	if onClose := c.ws.OnClose; nil != onClose {
+		defer c.recoverCloseCallback("OnClose")
 		onClose(c, ex)
 		return
 	}
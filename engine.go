@@ -17,7 +17,9 @@
 package nettyws
 
 import (
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-netty/go-netty"
 	"github.com/go-netty/go-netty-transport/websocket"
@@ -35,22 +37,75 @@ func (err ClosedError) Error() string {
 	return "ws closed: " + strconv.FormatUint(uint64(err.Code), 10) + " " + err.Reason
 }
 
+// HandshakeError returned when the server rejects the handshake request
+// with appropriate http status.
+type HandshakeError struct {
+	Status     int
+	Reason     string
+	RetryAfter time.Duration
+}
+
+// Error implements error interface.
+func (err HandshakeError) Error() string {
+	return "ws handshake rejected: " + strconv.Itoa(err.Status) + " " + err.Reason
+}
+
+// writeResponse write the rejected handshake response.
+func (err HandshakeError) writeResponse(writer http.ResponseWriter) {
+	if err.RetryAfter > 0 {
+		writer.Header().Set("Retry-After", strconv.FormatInt(int64((err.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+	http.Error(writer, err.Reason, err.Status)
+}
+
 // ErrServerClosed is returned by the Server call Shutdown or Close
 var ErrServerClosed = netty.ErrServerClosed
 
-var defaultEngine = netty.NewBootstrap(
-	netty.WithTransport(websocket.New()),
-	netty.WithChannel(netty.NewChannel()),
-	netty.WithChannelHolder(nil),
-	netty.WithClientInitializer(makeInitializer(true)),
-	netty.WithChildInitializer(makeInitializer(false)),
-)
+// ErrWriteQueueFull is returned when the async write queue is full and the message was dropped.
+var ErrWriteQueueFull = netty.ErrAsyncNoSpace
+
+var defaultEngine = NewEngine()
+
+// Engine runs the connections of the Websockets, several Websockets can share one engine.
+type Engine struct {
+	bootstrap netty.Bootstrap
+}
+
+// NewEngine create an engine can be shared by several Websockets with the WithEngine option, the nil options
+// are skipped. The websocket transport, channel holder and initializers are required by Websocket, they are
+// always set after the options and override netty.WithTransport, netty.WithChannelHolder,
+// netty.WithClientInitializer and netty.WithChildInitializer. The engine is owned by the caller,
+// Websocket.Close never shuts down the engine, call Shutdown after all the Websockets on it are closed.
+func NewEngine(option ...netty.Option) *Engine {
+	options := []netty.Option{netty.WithChannel(netty.NewChannel())}
+	for _, op := range option {
+		if nil != op {
+			options = append(options, op)
+		}
+	}
+	options = append(options,
+		netty.WithTransport(websocket.New()),
+		netty.WithChannelHolder(nil),
+		netty.WithClientInitializer(makeInitializer(true)),
+		netty.WithChildInitializer(makeInitializer(false)),
+	)
+
+	return &Engine{bootstrap: netty.NewBootstrap(options...)}
+}
+
+// Shutdown the engine, the Websockets on it are closed.
+func (e *Engine) Shutdown() {
+	e.bootstrap.Shutdown()
+}
 
 func makeInitializer(client bool) netty.ChannelInitializer {
 	return func(channel netty.Channel) {
 		ws := channel.Attachment().(*Websocket)
-		channel.Pipeline().
-			AddLast(ws.holder).
-			AddLast(newConn(ws, channel, client))
+		channel.Pipeline().AddLast(ws.holder)
+		// the user handlers between the holder and the Conn handler
+		if pipeline := ws.opts.pipeline; nil != pipeline {
+			pipeline(channel, channel.Pipeline())
+		}
+		channel.Pipeline().AddLast(newConn(ws, channel, client))
 	}
 }
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-netty/go-netty"
+	"github.com/go-netty/go-netty/transport/tcp"
+	"github.com/go-netty/go-netty/utils"
+)
+
+// countHandler counts the inbound bytes before the Conn handler.
+type countHandler struct {
+	active chan bool
+	opened *atomic.Bool
+	bytes  atomic.Int64
+}
+
+func (h *countHandler) HandleActive(ctx netty.ActiveContext) {
+	h.active <- h.opened.Load()
+	ctx.HandleActive()
+}
+
+func (h *countHandler) HandleRead(ctx netty.InboundContext, message netty.Message) {
+	ctx.HandleRead(&countReader{Reader: utils.MustToReader(message), bytes: &h.bytes})
+}
+
+// countReader counts the bytes read.
+type countReader struct {
+	io.Reader
+	bytes *atomic.Int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.bytes.Add(int64(n))
+	return n, err
+}
+
+func TestPipeline(t *testing.T) {
+	var opened atomic.Bool
+	handler := &countHandler{active: make(chan bool, 1), opened: &opened}
+	received := make(chan string, 2)
+	channels := make(chan netty.Channel, 1)
+
+	server := NewWebsocket(WithPipeline(func(channel netty.Channel, pipeline netty.Pipeline) {
+		channels <- channel
+		pipeline.AddLast(handler)
+	}))
+	server.OnOpen = func(conn Conn) {
+		opened.Store(true)
+	}
+	server.OnData = func(conn Conn, data []byte) {
+		received <- string(data)
+	}
+
+	conn := openTest(t, NewWebsocket(), serveTest(t, server))
+	for _, message := range []string{"hello", "world!"} {
+		if err := conn.Write([]byte(message)); nil != err {
+			t.Fatal(err)
+		}
+		if data := receiveTest(t, received); message != data {
+			t.Fatalf("received %q, want %q", data, message)
+		}
+	}
+
+	// the user handlers are before the Conn handler
+	if receiveTest(t, handler.active) {
+		t.Fatal("the user handler is active after OnOpen")
+	}
+	if bytes := handler.bytes.Load(); 11 != bytes {
+		t.Fatalf("the user handler reads %d bytes, want 11", bytes)
+	}
+
+	channel := receiveTest(t, channels)
+	if _, ok := channel.Attachment().(*Websocket); !ok {
+		t.Fatalf("the channel attachment is %T", channel.Attachment())
+	}
+}
+
+func TestNewEngine(t *testing.T) {
+	var cases = []struct {
+		name   string
+		option netty.Option
+	}{
+		{name: "executor", option: netty.WithExecutor(netty.AsyncExecutor())},
+		{name: "channel id", option: netty.WithChannelID(netty.SequenceID())},
+		{name: "transport", option: netty.WithTransport(tcp.New())},
+		{name: "holder", option: netty.WithChannelHolder(netty.NewChannelHolder(1))},
+		{name: "client initializer", option: netty.WithClientInitializer(func(netty.Channel) {})},
+		{name: "child initializer", option: netty.WithChildInitializer(func(netty.Channel) {})},
+		{name: "nil"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// the required options override the options
+			engine := NewEngine(c.option)
+			t.Cleanup(engine.Shutdown)
+
+			received := make(chan string, 1)
+			server := NewWebsocket(WithEngine(engine))
+			server.OnData = func(conn Conn, data []byte) {
+				received <- string(data)
+			}
+			conn := openTest(t, NewWebsocket(WithEngine(engine)), serveTest(t, server))
+			if err := conn.Write([]byte("hello")); nil != err {
+				t.Fatal(err)
+			}
+			if data := receiveTest(t, received); "hello" != data {
+				t.Fatalf("received %q, want hello", data)
+			}
+		})
+	}
+}
+
+func TestEngineShared(t *testing.T) {
+	engine := NewEngine(netty.WithExecutor(netty.AsyncExecutor()))
+	defer engine.Shutdown()
+
+	closed := make(chan error, 2)
+	server := NewWebsocket(WithEngine(engine))
+	server.OnClose = func(conn Conn, err error) {
+		closed <- err
+	}
+	url := serveTest(t, server)
+
+	// closing a Websocket keeps the shared engine running
+	client := NewWebsocket(WithEngine(engine))
+	openTest(t, client, url)
+	if err := client.Close(); nil != err {
+		t.Fatal(err)
+	}
+	receiveTest(t, closed)
+
+	conn := openTest(t, NewWebsocket(WithEngine(engine)), url)
+	if err := conn.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+
+	// shutting down the engine closes the connections on it
+	engine.Shutdown()
+	receiveTest(t, closed)
+}
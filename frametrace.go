@@ -0,0 +1,111 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+// FrameDirection is the direction of a traced frame.
+type FrameDirection int
+
+const (
+	// FrameIn is a received frame.
+	FrameIn FrameDirection = iota
+	// FrameOut is a sent frame.
+	FrameOut
+)
+
+// String returns the arrow of the direction.
+func (d FrameDirection) String() string {
+	if FrameIn == d {
+		return "<-"
+	}
+	return "->"
+}
+
+// FrameHeader is the header of a traced frame.
+type FrameHeader struct {
+	Fin    bool
+	Rsv    byte // RSV1, RSV2, RSV3 bits from high to low
+	OpCode byte
+	Masked bool
+	Mask   [4]byte
+	Length int64
+}
+
+// OpCodeName returns the name of the opcode.
+func (h FrameHeader) OpCodeName() string {
+	switch ws.OpCode(h.OpCode) {
+	case ws.OpContinuation:
+		return "CONTINUATION"
+	case ws.OpText:
+		return "TEXT"
+	case ws.OpBinary:
+		return "BINARY"
+	case ws.OpClose:
+		return "CLOSE"
+	case ws.OpPing:
+		return "PING"
+	case ws.OpPong:
+		return "PONG"
+	default:
+		return fmt.Sprintf("0x%x", h.OpCode)
+	}
+}
+
+// frameHeader convert the header of gobwas/ws.
+func frameHeader(header ws.Header) FrameHeader {
+	return FrameHeader{
+		Fin:    header.Fin,
+		Rsv:    header.Rsv,
+		OpCode: byte(header.OpCode),
+		Masked: header.Masked,
+		Mask:   header.Mask,
+		Length: header.Length,
+	}
+}
+
+// FrameTraceFunc is called for every frame sent and received on the connection with the remote address,
+// the payload is unmasked and truncated to the max payload size, compressed if the RSV1 bit is set.
+type FrameTraceFunc func(remoteAddr string, dir FrameDirection, header FrameHeader, payload []byte)
+
+// frameTraceWriter writes the traced frames with the hex dump of payload.
+func frameTraceWriter(w io.Writer) FrameTraceFunc {
+	var mutex sync.Mutex
+	return func(remoteAddr string, dir FrameDirection, header FrameHeader, payload []byte) {
+		line := fmt.Sprintf("%s %s %s %s fin=%t rsv=%03b mask=%t len=%d\n",
+			time.Now().Format(time.RFC3339Nano), remoteAddr, dir, header.OpCodeName(), header.Fin, header.Rsv, header.Masked, header.Length)
+
+		if len(payload) > 0 {
+			line += hex.Dump(payload)
+			if int64(len(payload)) < header.Length {
+				line += fmt.Sprintf("... %d bytes truncated\n", header.Length-int64(len(payload)))
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		_, _ = io.WriteString(w, line)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tracedFrame is a frame recorded by the frame trace.
+type tracedFrame struct {
+	dir     FrameDirection
+	header  FrameHeader
+	payload string
+}
+
+func TestFrameTrace(t *testing.T) {
+	var mutex sync.Mutex
+	var frames []tracedFrame
+	trace := func(remoteAddr string, dir FrameDirection, header FrameHeader, payload []byte) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if header.OpCode == 1 {
+			frames = append(frames, tracedFrame{dir: dir, header: header, payload: string(payload)})
+		}
+	}
+
+	echoed := make(chan string, 1)
+	server := NewWebsocket(WithFrameTrace(trace, 5))
+	server.OnData = func(conn Conn, data []byte) {
+		_ = conn.Write(data)
+	}
+
+	client := NewWebsocket()
+	client.OnData = func(conn Conn, data []byte) {
+		echoed <- string(data)
+	}
+
+	conn := openTest(t, client, serveTest(t, server))
+	if err := conn.Write([]byte("hello world")); nil != err {
+		t.Fatal(err)
+	}
+	if data := receiveTest(t, echoed); "hello world" != data {
+		t.Fatalf("echoed %q", data)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if 2 != len(frames) {
+		t.Fatalf("traced text frames %v", frames)
+	}
+
+	// the client frame is masked, the payload is unmasked and truncated
+	in, out := frames[0], frames[1]
+	if FrameIn != in.dir || !in.header.Masked || !in.header.Fin || 11 != in.header.Length || "hello" != in.payload {
+		t.Fatalf("traced in frame %+v", in)
+	}
+	if FrameOut != out.dir || out.header.Masked || 11 != out.header.Length || "hello" != out.payload {
+		t.Fatalf("traced out frame %+v", out)
+	}
+}
+
+func TestFrameTraceWriter(t *testing.T) {
+	var b strings.Builder
+	trace := frameTraceWriter(&b)
+	trace("127.0.0.1:9527", FrameIn, FrameHeader{Fin: true, Rsv: 4, OpCode: 2, Masked: true, Length: 20}, []byte("0123456789abcdef"))
+	trace("127.0.0.1:9527", FrameOut, FrameHeader{Fin: true, OpCode: 9}, nil)
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if 4 != len(lines) {
+		t.Fatalf("written:\n%s", b.String())
+	}
+
+	if !strings.HasSuffix(lines[0], " 127.0.0.1:9527 <- BINARY fin=true rsv=100 mask=true len=20") {
+		t.Fatalf("header line %q", lines[0])
+	}
+	if want := "00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|"; want != lines[1] {
+		t.Fatalf("dump line %q", lines[1])
+	}
+	if "... 4 bytes truncated" != lines[2] {
+		t.Fatalf("truncated line %q", lines[2])
+	}
+	if !strings.HasSuffix(lines[3], " 127.0.0.1:9527 -> PING fin=true rsv=000 mask=false len=0") {
+		t.Fatalf("header line %q", lines[3])
+	}
+}
+
+func TestFrameHeaderOpCodeName(t *testing.T) {
+	tests := []struct {
+		opCode byte
+		want   string
+	}{
+		{opCode: 0, want: "CONTINUATION"},
+		{opCode: 1, want: "TEXT"},
+		{opCode: 2, want: "BINARY"},
+		{opCode: 8, want: "CLOSE"},
+		{opCode: 9, want: "PING"},
+		{opCode: 10, want: "PONG"},
+		{opCode: 3, want: "0x3"},
+	}
+
+	for _, tt := range tests {
+		if got := (FrameHeader{OpCode: tt.opCode}).OpCodeName(); got != tt.want {
+			t.Errorf("OpCodeName(%d) = %s, want %s", tt.opCode, got, tt.want)
+		}
+	}
+}
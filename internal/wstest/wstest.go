@@ -0,0 +1,120 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package wstest provides the fake connection and the loopback helpers shared by the tests.
+package wstest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// Conn is a fake connection records the written messages, the methods not
+// implemented here panic as the embedded nettyws.Conn is nil.
+type Conn struct {
+	nettyws.Conn
+	// Name identifies the connection in the tests.
+	Name string
+	// OnWrite is called with a copy of the written message, the returned error is returned by Write.
+	OnWrite func(data []byte) error
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mutex   sync.Mutex
+	written [][]byte
+}
+
+// NewConn create a fake connection with the name.
+func NewConn(name string) *Conn {
+	c := &Conn{Name: name}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+func (c *Conn) Codec() nettyws.Codec {
+	return nettyws.JSON
+}
+
+// Write records a copy of the message, the data is the read buffer of the caller in the tests.
+func (c *Conn) Write(data []byte) error {
+	data = append([]byte(nil), data...)
+
+	c.mutex.Lock()
+	c.written = append(c.written, data)
+	c.mutex.Unlock()
+
+	if nil != c.OnWrite {
+		return c.OnWrite(data)
+	}
+	return nil
+}
+
+// Close cancels the context of the connection.
+func (c *Conn) Close() error {
+	c.cancel()
+	return nil
+}
+
+// Written returns the written messages.
+func (c *Conn) Written() [][]byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([][]byte(nil), c.written...)
+}
+
+// Serve serves the Websocket on a loopback http server, the websocket url is returned.
+func Serve(t testing.TB, ws *nettyws.Websocket) string {
+	t.Helper()
+	server := httptest.NewServer(ws)
+	t.Cleanup(func() {
+		_ = ws.Close()
+		server.Close()
+	})
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// Open opens a client connection of the Websocket, the client is closed with the test.
+func Open(t testing.TB, ws *nettyws.Websocket, url string) nettyws.Conn {
+	t.Helper()
+	conn, err := ws.Open(url)
+	if nil != err {
+		t.Fatalf("open %s: %v", url, err)
+	}
+	t.Cleanup(func() { _ = ws.Close() })
+	return conn
+}
+
+// Receive receives a value from the channel in a second.
+func Receive[T any](t testing.TB, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+		panic("unreachable")
+	}
+}
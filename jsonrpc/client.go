@@ -0,0 +1,149 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// NotificationFunc handles the notification of the server.
+type NotificationFunc func(method string, params json.RawMessage)
+
+// Client calls the methods of the server.
+type Client struct {
+	ws      *nettyws.Websocket
+	conn    nettyws.Conn
+	notify  NotificationFunc
+	nextID  atomic.Uint64
+	pending sync.Map // map<string, chan *message>
+	closed  chan struct{}
+}
+
+// Dial opens the websocket connection to the server with options, the notifications
+// of the server are handled by notify if not nil.
+func Dial(addr string, notify NotificationFunc, options ...nettyws.Option) (*Client, error) {
+	client := &Client{ws: nettyws.NewWebsocket(options...), notify: notify, closed: make(chan struct{})}
+	client.ws.OnData = client.onData
+	client.ws.OnClose = client.onClose
+
+	conn, err := client.ws.Open(addr)
+	if nil != err {
+		_ = client.ws.Close()
+		return nil, err
+	}
+	client.conn = conn
+	return client, nil
+}
+
+// Conn returns the connection of the client.
+func (c *Client) Conn() nettyws.Conn {
+	return c.conn
+}
+
+// Call calls the method and decodes the result to result if not nil.
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	req := request{Version: version, ID: json.RawMessage(strconv.FormatUint(c.nextID.Add(1), 10)), Method: method}
+	if nil != params {
+		data, err := json.Marshal(params)
+		if nil != err {
+			return err
+		}
+		req.Params = data
+	}
+
+	data, err := json.Marshal(&req)
+	if nil != err {
+		return err
+	}
+
+	replyCh := make(chan *message, 1)
+	c.pending.Store(string(req.ID), replyCh)
+	defer c.pending.Delete(string(req.ID))
+
+	if err = c.conn.Write(data); nil != err {
+		return err
+	}
+
+	select {
+	case reply := <-replyCh:
+		if nil != reply.Error {
+			return reply.Error
+		}
+		if nil != result {
+			return json.Unmarshal(reply.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrClosed
+	}
+}
+
+// Notify sends the notification to the server.
+func (c *Client) Notify(method string, params interface{}) error {
+	return Notify(c.conn, method, params)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.ws.Close()
+}
+
+func (c *Client) onData(_ nettyws.Conn, data []byte) {
+	if !isBatch(data) {
+		var msg message
+		if nil == json.Unmarshal(data, &msg) {
+			c.dispatch(&msg)
+		}
+		return
+	}
+
+	var batch []*message
+	if nil == json.Unmarshal(data, &batch) {
+		for _, msg := range batch {
+			c.dispatch(msg)
+		}
+	}
+}
+
+// dispatch delivers the response to the pending call or handles the notification.
+func (c *Client) dispatch(msg *message) {
+	if "" != msg.Method {
+		if nil != c.notify {
+			c.notify(msg.Method, msg.Params)
+		}
+		return
+	}
+
+	if replyCh, ok := c.pending.Load(string(msg.ID)); ok {
+		select {
+		case replyCh.(chan *message) <- msg:
+		default:
+		}
+	}
+}
+
+func (c *Client) onClose(nettyws.Conn, error) {
+	close(c.closed)
+}
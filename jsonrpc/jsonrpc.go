@@ -0,0 +1,119 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package jsonrpc implements the JSON-RPC 2.0 server and client over nettyws connections.
+//
+// The server registers Go functions as methods, serves the batch requests and notifications,
+// and sends the server initiated notifications with Notify. The client dials the server with
+// Websocket.Open and receives the notifications of the server.
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+const version = "2.0"
+
+// the error codes defined by JSON-RPC 2.0
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error is the error object of the response.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrClosed is returned by the pending calls when the connection is closed.
+var ErrClosed = errors.New("jsonrpc: connection closed")
+
+// request is the request or notification object.
+type request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification reports whether the request has no id.
+func (r *request) isNotification() bool {
+	return 0 == len(r.ID)
+}
+
+// response is the response object.
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// message is the request or response received by the client.
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// Notify sends the notification to the connection.
+func Notify(conn nettyws.Conn, method string, params interface{}) error {
+	data, err := marshalNotification(method, params)
+	if nil != err {
+		return err
+	}
+	return conn.Write(data)
+}
+
+// marshalNotification returns the notification message.
+func marshalNotification(method string, params interface{}) ([]byte, error) {
+	notification := request{Version: version, Method: method}
+	if nil != params {
+		data, err := json.Marshal(params)
+		if nil != err {
+			return nil, err
+		}
+		notification.Params = data
+	}
+	return json.Marshal(&notification)
+}
+
+// isBatch reports whether the message is a batch.
+func isBatch(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return '[' == c
+	}
+	return false
+}
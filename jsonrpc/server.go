@@ -0,0 +1,304 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	connType    = reflect.TypeOf((*nettyws.Conn)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// method is a registered function.
+type method struct {
+	fn        reflect.Value
+	hasCtx    bool
+	hasConn   bool
+	params    reflect.Type
+	hasResult bool
+}
+
+// newMethod checks the signature of the function:
+//
+//	func([ctx context.Context], [conn nettyws.Conn], [params P]) ([result R], error)
+func newMethod(fn interface{}) (*method, error) {
+	value := reflect.ValueOf(fn)
+	typ := value.Type()
+	if reflect.Func != typ.Kind() {
+		return nil, fmt.Errorf("jsonrpc: %s is not func", typ)
+	}
+
+	m := &method{fn: value}
+	in := 0
+	if in < typ.NumIn() && contextType == typ.In(in) {
+		m.hasCtx = true
+		in++
+	}
+	if in < typ.NumIn() && connType == typ.In(in) {
+		m.hasConn = true
+		in++
+	}
+	if in < typ.NumIn() {
+		m.params = typ.In(in)
+		in++
+	}
+	if in != typ.NumIn() {
+		return nil, fmt.Errorf("jsonrpc: too many arguments of %s", typ)
+	}
+
+	switch typ.NumOut() {
+	case 1:
+	case 2:
+		m.hasResult = true
+	default:
+		return nil, fmt.Errorf("jsonrpc: %s must return error or (result, error)", typ)
+	}
+	if errorType != typ.Out(typ.NumOut()-1) {
+		return nil, fmt.Errorf("jsonrpc: the last result of %s must be error", typ)
+	}
+	return m, nil
+}
+
+// call calls the function with the params.
+func (m *method) call(ctx context.Context, conn nettyws.Conn, params json.RawMessage) (interface{}, error) {
+	args := make([]reflect.Value, 0, 3)
+	if m.hasCtx {
+		args = append(args, reflect.ValueOf(ctx))
+	}
+	if m.hasConn {
+		args = append(args, reflect.ValueOf(&conn).Elem())
+	}
+	if nil != m.params {
+		arg := reflect.New(m.params)
+		if err := decodeParams(params, m.params, arg.Interface()); nil != err {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		args = append(args, arg.Elem())
+	}
+
+	out := m.fn.Call(args)
+	if err, _ := out[len(out)-1].Interface().(error); nil != err {
+		return nil, err
+	}
+	if m.hasResult {
+		return out[0].Interface(), nil
+	}
+	return nil, nil
+}
+
+// decodeParams decodes the by-name or by-position params, the single element of
+// the by-position params is decoded to the non-sequence type.
+func decodeParams(params json.RawMessage, typ reflect.Type, v interface{}) error {
+	if 0 == len(params) {
+		return nil
+	}
+
+	if kind := typ.Kind(); reflect.Slice != kind && reflect.Array != kind && isBatch(params) {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); nil != err {
+			return err
+		}
+		if 1 != len(positional) {
+			return fmt.Errorf("expect 1 param, got %d", len(positional))
+		}
+		params = positional[0]
+	}
+	return json.Unmarshal(params, v)
+}
+
+// Server serves the JSON-RPC 2.0 requests of connections.
+type Server struct {
+	mutex   sync.RWMutex
+	methods map[string]*method
+}
+
+// NewServer create a server.
+func NewServer() *Server {
+	return &Server{methods: make(map[string]*method)}
+}
+
+// Register registers the function as the method, the function must be
+//
+//	func([ctx context.Context], [conn nettyws.Conn], [params P]) ([result R], error)
+//
+// The ctx is the context of the connection, the returned *Error is responded as is.
+func (s *Server) Register(name string, fn interface{}) error {
+	m, err := newMethod(fn)
+	if nil != err {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.methods[name] = m
+	return nil
+}
+
+// RegisterService registers the exported methods of the receiver as "name.Method",
+// the methods with the other signatures are skipped.
+func (s *Server) RegisterService(name string, rcvr interface{}) error {
+	value := reflect.ValueOf(rcvr)
+	registered := 0
+	for i := 0; i < value.NumMethod(); i++ {
+		if err := s.Register(name+"."+value.Type().Method(i).Name, value.Method(i).Interface()); nil == err {
+			registered++
+		}
+	}
+
+	if 0 == registered {
+		return fmt.Errorf("jsonrpc: %s has no suitable methods", value.Type())
+	}
+	return nil
+}
+
+// Bind serves the requests of the Websocket connections, the OnData callback is replaced.
+func (s *Server) Bind(ws *nettyws.Websocket) {
+	ws.OnData = s.OnData
+}
+
+// OnData serves the request or batch in a new goroutine, use as the Websocket.OnData callback.
+func (s *Server) OnData(conn nettyws.Conn, data []byte) {
+	// the read buffer is reused after OnData returns
+	data = append([]byte(nil), data...)
+	go func() {
+		if reply := s.serve(conn, data); nil != reply {
+			_ = conn.Write(reply)
+		}
+	}()
+}
+
+// serve returns the response of the request or batch, nil returned if nothing to respond.
+func (s *Server) serve(conn nettyws.Conn, data []byte) []byte {
+	if !isBatch(data) {
+		var req request
+		if err := json.Unmarshal(data, &req); nil != err {
+			return marshalResponse(&response{Version: version, ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: err.Error()}})
+		}
+		if resp := s.handle(conn, &req); nil != resp {
+			return marshalResponse(resp)
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(data, &batch); nil != err {
+		return marshalResponse(&response{Version: version, ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: err.Error()}})
+	}
+	if 0 == len(batch) {
+		return marshalResponse(&response{Version: version, ID: json.RawMessage("null"), Error: &Error{Code: CodeInvalidRequest, Message: "empty batch"}})
+	}
+
+	// the requests of the batch are served concurrently
+	responses := make([]*response, len(batch))
+	var wg sync.WaitGroup
+	for i := range batch {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var req request
+			if err := json.Unmarshal(batch[i], &req); nil != err {
+				responses[i] = &response{Version: version, ID: json.RawMessage("null"), Error: &Error{Code: CodeInvalidRequest, Message: err.Error()}}
+				return
+			}
+			responses[i] = s.handle(conn, &req)
+		}(i)
+	}
+	wg.Wait()
+
+	replies := make([]*response, 0, len(responses))
+	for _, resp := range responses {
+		if nil != resp {
+			replies = append(replies, resp)
+		}
+	}
+
+	// all notifications
+	if 0 == len(replies) {
+		return nil
+	}
+
+	reply, _ := json.Marshal(replies)
+	return reply
+}
+
+// handle calls the method of the request, nil returned for the notification.
+// The panic of the method is recovered and responded with the internal error.
+func (s *Server) handle(conn nettyws.Conn, req *request) (resp *response) {
+	defer func() {
+		if nil != recover() {
+			resp = nil
+			if !req.isNotification() {
+				resp = &response{Version: version, ID: req.ID, Error: &Error{Code: CodeInternalError, Message: "internal error"}}
+			}
+		}
+	}()
+
+	resp = &response{Version: version, ID: req.ID}
+	if version != req.Version || "" == req.Method {
+		if 0 == len(resp.ID) {
+			resp.ID = json.RawMessage("null")
+		}
+		resp.Error = &Error{Code: CodeInvalidRequest, Message: "invalid request"}
+		return resp
+	}
+
+	s.mutex.RLock()
+	m, ok := s.methods[req.Method]
+	s.mutex.RUnlock()
+
+	var result interface{}
+	var err error
+	if ok {
+		result, err = m.call(conn.Context(), conn, req.Params)
+	} else {
+		err = &Error{Code: CodeMethodNotFound, Message: "method not found"}
+	}
+
+	if req.isNotification() {
+		return nil
+	}
+
+	if nil != err {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+
+	if resp.Result, err = json.Marshal(result); nil != err {
+		resp.Result, resp.Error = nil, &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	return resp
+}
+
+// marshalResponse returns the response message.
+func marshalResponse(resp *response) []byte {
+	data, _ := json.Marshal(resp)
+	return data
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+// replyConn returns a fake conn sends the responses of the server to the channel.
+func replyConn() (*wstest.Conn, chan string) {
+	conn, replies := wstest.NewConn("client"), make(chan string, 1)
+	conn.OnWrite = func(data []byte) error {
+		replies <- string(data)
+		return nil
+	}
+	return conn, replies
+}
+
+func TestServerOnData(t *testing.T) {
+	server := NewServer()
+	if err := server.Register("sum", func(values []int) (int, error) {
+		return values[0] + values[1], nil
+	}); nil != err {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "request", data: `{"jsonrpc":"2.0","id":1,"method":"sum","params":[1,2]}`, want: `{"jsonrpc":"2.0","id":1,"result":3}`},
+		{name: "method not found", data: `{"jsonrpc":"2.0","id":"a","method":"missing"}`, want: `{"jsonrpc":"2.0","id":"a","error":{"code":-32601,"message":"method not found"}}`},
+		{name: "invalid request", data: `{"jsonrpc":"1.0","id":2,"method":"sum"}`, want: `{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"invalid request"}}`},
+		{name: "empty batch", data: `[]`, want: `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"empty batch"}}`},
+		{name: "batch", data: `[{"jsonrpc":"2.0","id":1,"method":"sum","params":[1,2]},{"jsonrpc":"2.0","method":"sum","params":[1,2]}]`, want: `[{"jsonrpc":"2.0","id":1,"result":3}]`},
+		{name: "notification", data: `{"jsonrpc":"2.0","method":"sum","params":[1,2]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, replies := replyConn()
+
+			// the read buffer is reused after OnData returns
+			buffer := []byte(tt.data)
+			server.OnData(conn, buffer)
+			for index := range buffer {
+				buffer[index] = ' '
+			}
+
+			select {
+			case reply := <-replies:
+				if reply != tt.want {
+					t.Fatalf("reply %s, want %s", reply, tt.want)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if "" != tt.want {
+					t.Fatalf("no reply, want %s", tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestServerPanic(t *testing.T) {
+	server := NewServer()
+	if err := server.Register("panic", func(values []int) (int, error) {
+		return values[2], nil
+	}); nil != err {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "request", data: `{"jsonrpc":"2.0","id":1,"method":"panic","params":[1]}`, want: `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"internal error"}}`},
+		{name: "batch", data: `[{"jsonrpc":"2.0","id":1,"method":"panic","params":[1]},{"jsonrpc":"2.0","method":"panic","params":[1]}]`, want: `[{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"internal error"}}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, replies := replyConn()
+			server.OnData(conn, []byte(tt.data))
+			if reply := wstest.Receive(t, replies); reply != tt.want {
+				t.Fatalf("reply %s, want %s", reply, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	server := NewServer()
+	if err := server.Register("sum", func(ctx context.Context, conn nettyws.Conn, values []int) (int, error) {
+		if err := Notify(conn, "progress", "summing"); nil != err {
+			return 0, err
+		}
+		return values[0] + values[1], nil
+	}); nil != err {
+		t.Fatal(err)
+	}
+	ws := nettyws.NewWebsocket()
+	server.Bind(ws)
+
+	notifications := make(chan string, 1)
+	client, err := Dial(wstest.Serve(t, ws), func(method string, params json.RawMessage) {
+		notifications <- method + " " + string(params)
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var sum int
+	if err := client.Call(context.Background(), "sum", []int{1, 2}, &sum); nil != err || 3 != sum {
+		t.Fatalf("sum = %d, %v, want 3", sum, err)
+	}
+	if notification := wstest.Receive(t, notifications); `progress "summing"` != notification {
+		t.Fatalf("notification %s", notification)
+	}
+}
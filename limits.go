@@ -0,0 +1,140 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connLimiter limits the server connections in total and per remote ip.
+type connLimiter struct {
+	mutex      sync.Mutex
+	maxTotal   int
+	maxPerIP   int
+	total      int
+	perIP      map[string]int
+	retryAfter time.Duration
+}
+
+// newConnLimiter create a connection limiter, nil returned if no limits are specified.
+func newConnLimiter(maxTotal, maxPerIP int) *connLimiter {
+	if maxTotal <= 0 && maxPerIP <= 0 {
+		return nil
+	}
+	return &connLimiter{maxTotal: maxTotal, maxPerIP: maxPerIP, perIP: make(map[string]int), retryAfter: time.Second}
+}
+
+// acquire a connection of the ip, HandshakeError returned if the limit is reached.
+func (l *connLimiter) acquire(ip string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return HandshakeError{Status: http.StatusServiceUnavailable, Reason: "too many connections", RetryAfter: l.retryAfter}
+	}
+
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return HandshakeError{Status: http.StatusTooManyRequests, Reason: "too many connections from " + ip, RetryAfter: l.retryAfter}
+	}
+
+	l.total++
+	l.perIP[ip]++
+	return nil
+}
+
+// release a connection of the ip.
+func (l *connLimiter) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// trustedProxies is the list of proxy networks whose forwarding headers are trusted.
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies parse the ip or cidr list of the proxies.
+func parseTrustedProxies(proxies ...string) (trustedProxies, error) {
+	prefixes := make(trustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if nil != err {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if nil != addrErr {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// trusted reports whether the ip is a trusted proxy.
+func (tp trustedProxies) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if nil != err {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range tp {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the ip of the client, the forwarding headers are only used
+// when the request comes from a trusted proxy.
+func (tp trustedProxies) clientIP(request *http.Request) string {
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if nil != err {
+		ip = request.RemoteAddr
+	}
+
+	if !tp.trusted(ip) {
+		return ip
+	}
+
+	// the right-most untrusted address is the client
+	if forwarded := request.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for index := len(addrs) - 1; index >= 0; index-- {
+			if addr := strings.TrimSpace(addrs[index]); "" != addr {
+				if ip = addr; !tp.trusted(ip) {
+					break
+				}
+			}
+		}
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(request.Header.Get("X-Real-IP")); "" != realIP {
+		return realIP
+	}
+	return ip
+}
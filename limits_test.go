@@ -0,0 +1,97 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		wantErr bool
+	}{
+		{name: "ip", proxies: []string{"10.0.0.1", "::1"}},
+		{name: "cidr", proxies: []string{"10.0.0.0/8", "fd00::/8"}},
+		{name: "malformed ip", proxies: []string{"10.0.0.256"}, wantErr: true},
+		{name: "malformed cidr", proxies: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTrustedProxies(tt.proxies...); (nil != err) != tt.wantErr {
+				t.Fatalf("parseTrustedProxies(%q) error = %v, wantErr %t", tt.proxies, err, tt.wantErr)
+			}
+
+			if opts := parseOptions(WithTrustedProxies(tt.proxies...)); (nil != opts.err) != tt.wantErr {
+				t.Fatalf("WithTrustedProxies(%q) error = %v, wantErr %t", tt.proxies, opts.err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{name: "direct", remoteAddr: "1.2.3.4:5", header: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "1.2.3.4"},
+		{name: "forwarded", remoteAddr: "10.0.0.1:5", header: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "9.9.9.9"},
+		{name: "right-most untrusted", remoteAddr: "10.0.0.1:5", header: http.Header{"X-Forwarded-For": {"6.6.6.6, 9.9.9.9, 10.0.0.2"}}, want: "9.9.9.9"},
+		{name: "real ip", remoteAddr: "10.0.0.1:5", header: http.Header{"X-Real-Ip": {"9.9.9.9"}}, want: "9.9.9.9"},
+		{name: "no header", remoteAddr: "10.0.0.1:5", header: http.Header{}, want: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.header}
+			if got := proxies.clientIP(request); got != tt.want {
+				t.Fatalf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	limiter := newConnLimiter(3, 2)
+	for index, ip := range []string{"a", "a", "b"} {
+		if err := limiter.acquire(ip); nil != err {
+			t.Fatalf("acquire #%d: %v", index, err)
+		}
+	}
+
+	if err, ok := limiter.acquire("c").(HandshakeError); !ok || http.StatusServiceUnavailable != err.Status {
+		t.Fatalf("acquire over total = %v", err)
+	}
+
+	limiter.release("b")
+	if err, ok := limiter.acquire("a").(HandshakeError); !ok || http.StatusTooManyRequests != err.Status {
+		t.Fatalf("acquire over per ip = %v", err)
+	}
+	if err := limiter.acquire("b"); nil != err {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
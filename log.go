@@ -0,0 +1,102 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// log writes the event if the logger is enabled for the level.
+func (ws *Websocket) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if logger := ws.opts.logger; nil != logger && logger.Enabled(ctx, level) {
+		logger.LogAttrs(ctx, level, msg, attrs...)
+	}
+}
+
+// logHandshakeError logs the rejected handshake request.
+func (ws *Websocket) logHandshakeError(request *http.Request, err error) {
+	ws.log(request.Context(), slog.LevelInfo, "websocket handshake failed", slog.String("remote_addr", request.RemoteAddr),
+		slog.Int("status", rejectStatus(err)), slog.String("reason", err.Error()))
+}
+
+// log writes the event with the connection id and remote address.
+func (c *wsConn) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if logger := c.ws.opts.logger; nil != logger && logger.Enabled(c.ctx, level) {
+		attrs = append(attrs, slog.Int64("conn_id", c.channel.ID()), slog.String("remote_addr", c.channel.RemoteAddr()))
+		logger.LogAttrs(c.ctx, level, msg, attrs...)
+	}
+}
+
+// logReadError logs the protocol errors and oversized frames.
+func (c *wsConn) logReadError(err error) {
+	var protocolErr ws.ProtocolError
+	switch {
+	case errors.Is(err, wsutil.ErrFrameTooLarge):
+		c.log(slog.LevelInfo, "websocket frame too large", slog.Int64("max_frame_size", c.ws.options.MaxFrameSize))
+	case errors.As(err, &protocolErr):
+		c.log(slog.LevelInfo, "websocket protocol error", slog.String("error", protocolErr.Error()))
+	}
+}
+
+// logClose logs the close code and reason.
+func (c *wsConn) logClose(err error) {
+	code := closeCode(err)
+
+	level := slog.LevelInfo
+	if 1000 == code || 1001 == code {
+		level = slog.LevelDebug
+	}
+
+	attrs := []slog.Attr{slog.Int("code", code)}
+	var closedErr ClosedError
+	if errors.As(err, &closedErr) {
+		attrs = append(attrs, slog.String("reason", closedErr.Reason))
+	} else if nil != err {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	c.log(level, "websocket connection closed", attrs...)
+}
+
+// recoverCallback logs the panic of the callback and panics again.
+func (c *wsConn) recoverCallback(callback string) {
+	if err := recover(); nil != err {
+		c.logPanic(callback, err)
+		panic(err)
+	}
+}
+
+// recoverCloseCallback logs the panic of the close callback without panicking again,
+// the remaining close callbacks still run to release the state of the connection.
+func (c *wsConn) recoverCloseCallback(callback string) {
+	if err := recover(); nil != err {
+		c.logPanic(callback, err)
+	}
+}
+
+// logPanic logs the panic of the callback with the stack.
+func (c *wsConn) logPanic(callback string, err interface{}) {
+	c.log(slog.LevelError, "websocket callback panic", slog.String("callback", callback),
+		slog.String("panic", fmt.Sprint(err)), slog.String("stack", string(debug.Stack())))
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordHandler records the messages and attributes of the log records.
+type recordHandler struct {
+	mutex   sync.Mutex
+	records []map[string]string
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, record slog.Record) error {
+	attrs := map[string]string{"msg": record.Message, "level": record.Level.String()}
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs[attr.Key] = attr.Value.String()
+		return true
+	})
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = append(h.records, attrs)
+	return nil
+}
+
+// find returns the first record with the message.
+func (h *recordHandler) find(msg string) map[string]string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, record := range h.records {
+		if msg == record["msg"] {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestLogHandshakeFailed(t *testing.T) {
+	handler := &recordHandler{}
+	server := httptest.NewServer(NewWebsocket(WithLogger(slog.New(handler)), WithHandshakeRateLimit(1)))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := NewWebsocket()
+	defer client.Close()
+	if _, err := client.Open(url); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := client.Open(url); nil == err {
+		t.Fatal("the second handshake should be rejected")
+	}
+
+	record := handler.find("websocket handshake failed")
+	if nil == record || "429" != record["status"] || "INFO" != record["level"] {
+		t.Fatalf("handshake failed record %v", record)
+	}
+}
+
+func TestLogConnection(t *testing.T) {
+	handler := &recordHandler{}
+	closed := make(chan struct{})
+
+	server := NewWebsocket(WithLogger(slog.New(handler)))
+	server.OnOpen = func(conn Conn) {
+		_ = conn.WriteClose(4000, "bye")
+	}
+	server.OnClose = func(conn Conn, err error) {
+		close(closed)
+	}
+
+	openTest(t, NewWebsocket(), serveTest(t, server))
+	receiveTest(t, closed)
+
+	if record := handler.find("websocket connection opened"); nil == record || "" == record["conn_id"] || "" == record["remote_addr"] {
+		t.Fatalf("opened record %v", record)
+	}
+	if record := handler.find("websocket connection closed"); nil == record || "INFO" != record["level"] {
+		t.Fatalf("closed record %v", record)
+	}
+}
+
+func TestCloseCallbackPanic(t *testing.T) {
+	handler := &recordHandler{}
+	calls := make(chan string, 4)
+	closed := make(chan struct{})
+
+	server := NewWebsocket(WithLogger(slog.New(handler)))
+	server.UseClose(func(conn Conn, err error) {
+		calls <- "first"
+		panic("close callback panic")
+	}, func(conn Conn, err error) {
+		calls <- "second"
+	})
+	server.OnOpen = func(conn Conn) {
+		_ = conn.Close()
+	}
+	server.OnClose = func(conn Conn, err error) {
+		calls <- "OnClose"
+		close(closed)
+	}
+
+	openTest(t, NewWebsocket(), serveTest(t, server))
+
+	// the panic does not skip the remaining close callbacks
+	receiveTest(t, closed)
+	for _, want := range []string{"first", "second", "OnClose"} {
+		if call := receiveTest(t, calls); want != call {
+			t.Fatalf("call %s, want %s", call, want)
+		}
+	}
+
+	record := handler.find("websocket callback panic")
+	if nil == record || "UseClose" != record["callback"] || "close callback panic" != record["panic"] {
+		t.Fatalf("panic record %v", record)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+)
+
+// Metrics receives the events of the Websocket for monitoring,
+// the methods must be safe for concurrent use.
+type Metrics interface {
+	// HandshakeAccepted is called when a handshake request is upgraded.
+	HandshakeAccepted()
+	// HandshakeRejected is called when a handshake request is rejected with http status.
+	HandshakeRejected(status int)
+	// ConnOpened is called when a connection is opened.
+	ConnOpened(client bool)
+	// ConnClosed is called when a connection is closed with close code.
+	ConnClosed(client bool, code int)
+	// MessageIn is called when a message is received.
+	MessageIn(size int)
+	// MessageOut is called when a message is sent.
+	MessageOut(size int)
+	// CompressionSaved is called when a connection is closed with the bytes saved by
+	// compression, only available with the WithFrameStats option.
+	CompressionSaved(bytes int64)
+	// WriteQueueDepth is called with the total messages queued by async write of all the
+	// connections of the Websocket when it changes, the calls are serialized.
+	WriteQueueDepth(messages int)
+	// Error is called when an error occurs on a connection.
+	Error(err error)
+}
+
+// nopMetrics is the default Metrics discards all events.
+type nopMetrics struct{}
+
+func (nopMetrics) HandshakeAccepted()     {}
+func (nopMetrics) HandshakeRejected(int)  {}
+func (nopMetrics) ConnOpened(bool)        {}
+func (nopMetrics) ConnClosed(bool, int)   {}
+func (nopMetrics) MessageIn(int)          {}
+func (nopMetrics) MessageOut(int)         {}
+func (nopMetrics) CompressionSaved(int64) {}
+func (nopMetrics) WriteQueueDepth(int)    {}
+func (nopMetrics) Error(error)            {}
+
+// closeCode returns the websocket close code of the close error.
+func closeCode(err error) int {
+	var closedErr ClosedError
+	switch {
+	case nil == err:
+		return 1000
+	case errors.As(err, &closedErr):
+		return closedErr.Code
+	default:
+		return 1006
+	}
+}
+
+// rejectStatus returns the http status of the rejected handshake error.
+func rejectStatus(err error) int {
+	var handshakeErr HandshakeError
+	var statusErr interface{ StatusCode() int }
+	switch {
+	case errors.As(err, &handshakeErr):
+		return handshakeErr.Status
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode()
+	default:
+		return http.StatusNotAcceptable
+	}
+}
+
+// addWriteQueueDepth aggregates the depth of the write queues of all connections,
+// the total is reported by Metrics.WriteQueueDepth.
+func (ws *Websocket) addWriteQueueDepth(delta int) {
+	ws.queueDepthMutex.Lock()
+	defer ws.queueDepthMutex.Unlock()
+	ws.queueDepth += delta
+	ws.metrics.WriteQueueDepth(ws.queueDepth)
+}
+
+// expvarMetrics publishes the metrics through the expvar package,
+// the write_queue_depth is the total of queued messages of all connections.
+type expvarMetrics struct {
+	handshakesAccepted expvar.Int
+	handshakesRejected expvar.Map
+	connsOpened        expvar.Int
+	connsActive        expvar.Int
+	connsClosed        expvar.Map
+	messagesIn         expvar.Int
+	bytesIn            expvar.Int
+	messagesOut        expvar.Int
+	bytesOut           expvar.Int
+	compressionSaved   expvar.Int
+	writeQueueDepth    expvar.Int
+	errors             expvar.Int
+}
+
+// NewExpvarMetrics create a Metrics published as an expvar.Map with the name,
+// it panics if the name is already registered.
+func NewExpvarMetrics(name string) Metrics {
+	m := &expvarMetrics{}
+	vars := expvar.NewMap(name)
+	vars.Set("handshakes_accepted", &m.handshakesAccepted)
+	vars.Set("handshakes_rejected", m.handshakesRejected.Init())
+	vars.Set("conns_opened", &m.connsOpened)
+	vars.Set("conns_active", &m.connsActive)
+	vars.Set("conns_closed", m.connsClosed.Init())
+	vars.Set("messages_in", &m.messagesIn)
+	vars.Set("bytes_in", &m.bytesIn)
+	vars.Set("messages_out", &m.messagesOut)
+	vars.Set("bytes_out", &m.bytesOut)
+	vars.Set("compression_saved_bytes", &m.compressionSaved)
+	vars.Set("write_queue_depth", &m.writeQueueDepth)
+	vars.Set("errors", &m.errors)
+	return m
+}
+
+func (m *expvarMetrics) HandshakeAccepted() {
+	m.handshakesAccepted.Add(1)
+}
+
+func (m *expvarMetrics) HandshakeRejected(status int) {
+	m.handshakesRejected.Add(strconv.Itoa(status), 1)
+}
+
+func (m *expvarMetrics) ConnOpened(client bool) {
+	m.connsOpened.Add(1)
+	m.connsActive.Add(1)
+}
+
+func (m *expvarMetrics) ConnClosed(client bool, code int) {
+	m.connsActive.Add(-1)
+	m.connsClosed.Add(strconv.Itoa(code), 1)
+}
+
+func (m *expvarMetrics) MessageIn(size int) {
+	m.messagesIn.Add(1)
+	m.bytesIn.Add(int64(size))
+}
+
+func (m *expvarMetrics) MessageOut(size int) {
+	m.messagesOut.Add(1)
+	m.bytesOut.Add(int64(size))
+}
+
+func (m *expvarMetrics) CompressionSaved(bytes int64) {
+	m.compressionSaved.Add(bytes)
+}
+
+func (m *expvarMetrics) WriteQueueDepth(messages int) {
+	m.writeQueueDepth.Set(int64(messages))
+}
+
+func (m *expvarMetrics) Error(err error) {
+	m.errors.Add(1)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestExpvarWriteQueueDepth(t *testing.T) {
+	metrics := NewExpvarMetrics("nettyws_test_queue_depth").(*expvarMetrics)
+	ws := NewWebsocket(WithMetrics(metrics))
+
+	channel := newFakeChannel()
+	channel.release = make(chan struct{})
+	queues := []*writeQueue{newWriteQueue(channel, 4, QueueDropNewest), newWriteQueue(channel, 4, QueueDropNewest)}
+	for _, queue := range queues {
+		queue.depth = ws.addWriteQueueDepth
+		for _, message := range []string{"a", "b"} {
+			if err := queue.push([]byte(message), nil); nil != err {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if depth := metrics.writeQueueDepth.Value(); depth != 4 {
+		t.Fatalf("write_queue_depth = %d, want the total 4", depth)
+	}
+
+	close(channel.release)
+	for _, queue := range queues {
+		queue.wait()
+	}
+
+	if depth := metrics.writeQueueDepth.Value(); depth != 0 {
+		t.Fatalf("write_queue_depth = %d after sent, want 0", depth)
+	}
+}
+
+func TestCloseCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: nil, want: 1000},
+		{err: ClosedError{Code: 1008}, want: 1008},
+		{err: errors.Join(errors.New("wrapped"), ClosedError{Code: 1011}), want: 1011},
+		{err: errors.New("reset"), want: 1006},
+	}
+
+	for _, tt := range tests {
+		if got := closeCode(tt.err); got != tt.want {
+			t.Errorf("closeCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRejectStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: HandshakeError{Status: http.StatusTooManyRequests}, want: http.StatusTooManyRequests},
+		{err: errors.New("bad request"), want: http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		if got := rejectStatus(tt.err); got != tt.want {
+			t.Errorf("rejectStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
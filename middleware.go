@@ -0,0 +1,115 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+// Handler handles an inbound message.
+type Handler func(conn Conn, data []byte)
+
+// Middleware wraps the next inbound Handler, the message is dropped if next is not called.
+// A wrapper of the Conn passed to next should implement Unwrapper.
+type Middleware func(next Handler) Handler
+
+// Unwrapper is implemented by the Conn wrappers to return the wrapped Conn.
+type Unwrapper interface {
+	Unwrap() Conn
+}
+
+// Unwrap returns the Conn under the wrappers implementing Unwrapper, conn itself is returned if it is
+// not a wrapper. The packages keeping the state of connections use it as the key of the connection.
+func Unwrap(conn Conn) Conn {
+	for {
+		unwrapper, ok := conn.(Unwrapper)
+		if !ok {
+			return conn
+		}
+		conn = unwrapper.Unwrap()
+	}
+}
+
+// unwrapConn returns the websocket connection under the wrappers, nil returned
+// if a wrapper does not implement Unwrapper.
+func unwrapConn(conn Conn) *wsConn {
+	for {
+		switch c := conn.(type) {
+		case *wsConn:
+			return c
+		case Unwrapper:
+			conn = c.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// WriteHandler writes an outbound message.
+type WriteHandler func(conn Conn, message []byte) error
+
+// WriteMiddleware wraps the next WriteHandler around Conn.Write, the message is dropped if next is not called.
+type WriteMiddleware func(next WriteHandler) WriteHandler
+
+// Use appends the middlewares around the inbound messages before OnData, the first one is the outermost.
+// The middlewares run inside the Conn handler at the tail of the netty pipeline, Use must be called
+// before Listen, Open or UpgradeHTTP.
+func (ws *Websocket) Use(middlewares ...Middleware) {
+	ws.middlewares = append(ws.middlewares, middlewares...)
+
+	inbound := Handler(ws.dispatch)
+	for i := len(ws.middlewares) - 1; i >= 0; i-- {
+		inbound = ws.middlewares[i](inbound)
+	}
+	ws.inbound = inbound
+}
+
+// UseWrite appends the middlewares around Conn.Write, the first one is the outermost.
+// The middlewares run before the async write queue, UseWrite must be called before Listen, Open or UpgradeHTTP.
+func (ws *Websocket) UseWrite(middlewares ...WriteMiddleware) {
+	ws.writeMiddlewares = append(ws.writeMiddlewares, middlewares...)
+}
+
+// UseOpen appends the callbacks invoked before OnOpen when a connection is opened, they are kept
+// when OnOpen is reassigned. UseOpen must be called before Listen, Open or UpgradeHTTP.
+func (ws *Websocket) UseOpen(callbacks ...OnOpenFunc) {
+	ws.openCallbacks = append(ws.openCallbacks, callbacks...)
+}
+
+// UseClose appends the callbacks invoked before OnClose when a connection is closed, they are kept
+// when OnClose is reassigned. UseClose must be called before Listen, Open or UpgradeHTTP.
+func (ws *Websocket) UseClose(callbacks ...OnCloseFunc) {
+	ws.closeCallbacks = append(ws.closeCallbacks, callbacks...)
+}
+
+// dispatch invokes the OnData callback.
+func (ws *Websocket) dispatch(conn Conn, data []byte) {
+	if onData := ws.OnData; nil != onData {
+		onData(conn, data)
+	}
+}
+
+// outbound returns the write middlewares chain of the connection, nil returned if no middleware.
+func (ws *Websocket) outbound(c *wsConn) WriteHandler {
+	if 0 == len(ws.writeMiddlewares) {
+		return nil
+	}
+
+	outbound := WriteHandler(func(_ Conn, message []byte) error {
+		return c.write(message)
+	})
+	for i := len(ws.writeMiddlewares) - 1; i >= 0; i-- {
+		outbound = ws.writeMiddlewares[i](outbound)
+	}
+	return outbound
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	var events = make(chan string, 16)
+	var received = make(chan string, 1)
+
+	server := NewWebsocket()
+	server.Use(func(next Handler) Handler {
+		return func(conn Conn, data []byte) {
+			events <- "first"
+			next(conn, data)
+		}
+	}, func(next Handler) Handler {
+		return func(conn Conn, data []byte) {
+			events <- "second"
+			next(conn, data)
+		}
+	})
+	server.OnData = func(conn Conn, data []byte) {
+		received <- string(data)
+	}
+
+	client := NewWebsocket()
+	client.UseWrite(func(next WriteHandler) WriteHandler {
+		return func(conn Conn, message []byte) error {
+			events <- "outer"
+			return next(conn, append([]byte("<"), message...))
+		}
+	}, func(next WriteHandler) WriteHandler {
+		return func(conn Conn, message []byte) error {
+			events <- "inner"
+			if "<drop" == string(message) {
+				return errors.New("dropped")
+			}
+			return next(conn, append(message, '>'))
+		}
+	})
+
+	conn := openTest(t, client, serveTest(t, server))
+	if err := conn.Write([]byte("drop")); nil == err {
+		t.Fatal("the write middleware should drop the message")
+	}
+	if err := conn.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+
+	if data := receiveTest(t, received); "<hello>" != data {
+		t.Fatalf("received %q", data)
+	}
+
+	var order []string
+	for len(events) > 0 {
+		order = append(order, <-events)
+	}
+	if want := []string{"outer", "inner", "outer", "inner", "first", "second"}; !reflect.DeepEqual(want, order) {
+		t.Fatalf("order %v, want %v", order, want)
+	}
+}
+
+func TestUseOpenClose(t *testing.T) {
+	var events = make(chan string, 8)
+	var closed = make(chan struct{})
+
+	server := NewWebsocket()
+	server.UseOpen(func(conn Conn) { events <- "UseOpen" })
+	server.UseClose(func(conn Conn, err error) { events <- "UseClose" })
+
+	// the callbacks are kept when OnOpen and OnClose are assigned later
+	server.OnOpen = func(conn Conn) {
+		events <- "OnOpen"
+		_ = conn.Close()
+	}
+	server.OnClose = func(conn Conn, err error) {
+		events <- "OnClose"
+		close(closed)
+	}
+
+	openTest(t, NewWebsocket(), serveTest(t, server))
+	receiveTest(t, closed)
+
+	var order []string
+	for len(events) > 0 {
+		order = append(order, <-events)
+	}
+	if want := []string{"UseOpen", "OnOpen", "UseClose", "OnClose"}; !reflect.DeepEqual(want, order) {
+		t.Fatalf("order %v, want %v", order, want)
+	}
+}
+
+// wrapConn is a Conn wrapper of a middleware.
+type wrapConn struct {
+	Conn
+}
+
+func (c wrapConn) Unwrap() Conn {
+	return c.Conn
+}
+
+func TestUnwrap(t *testing.T) {
+	opened := make(chan Conn, 1)
+	received := make(chan Conn, 1)
+
+	server := NewWebsocket()
+	server.Use(func(next Handler) Handler {
+		return func(conn Conn, data []byte) {
+			next(wrapConn{Conn: conn}, data)
+		}
+	}, func(next Handler) Handler {
+		return func(conn Conn, data []byte) {
+			next(wrapConn{Conn: conn}, data)
+		}
+	})
+	server.OnOpen = func(conn Conn) {
+		opened <- conn
+	}
+	server.OnData = func(conn Conn, data []byte) {
+		received <- conn
+	}
+
+	conn := openTest(t, NewWebsocket(), serveTest(t, server))
+	if err := conn.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+
+	serverConn, wrapped := receiveTest(t, opened), receiveTest(t, received)
+	if serverConn == wrapped {
+		t.Fatal("the conn is not wrapped by the middlewares")
+	}
+	if Unwrap(wrapped) != serverConn || Unwrap(serverConn) != serverConn {
+		t.Fatal("Unwrap does not return the conn under the wrappers")
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// frame types
+const (
+	typeData byte = iota
+	typeWindowUpdate
+	typeGoAway
+)
+
+// frame flags
+const (
+	flagSYN uint16 = 1 << iota
+	flagACK
+	flagFIN
+	flagRST
+)
+
+const (
+	protoVersion = 0
+	headerSize   = 12
+	// the initial receive window of streams
+	initialWindow = 256 << 10
+	// the max payload of a data frame
+	maxPayload = 16 << 10
+)
+
+var errBadFrame = errors.New("mux: bad frame")
+
+// header is the frame header:
+//
+//	version(1) | type(1) | flags(2) | stream id(4) | length(4)
+//
+// The length is the payload size of the data frame, or the window delta of the window update.
+type header struct {
+	typ      byte
+	flags    uint16
+	streamID uint32
+	length   uint32
+}
+
+// encodeFrame returns the binary message of the frame.
+func encodeFrame(h header, payload []byte) []byte {
+	frame := make([]byte, headerSize, headerSize+len(payload))
+	frame[0] = protoVersion
+	frame[1] = h.typ
+	binary.BigEndian.PutUint16(frame[2:], h.flags)
+	binary.BigEndian.PutUint32(frame[4:], h.streamID)
+	binary.BigEndian.PutUint32(frame[8:], h.length)
+	return append(frame, payload...)
+}
+
+// decodeFrame returns the header and payload of the binary message.
+func decodeFrame(frame []byte) (h header, payload []byte, err error) {
+	if len(frame) < headerSize || protoVersion != frame[0] {
+		return h, nil, errBadFrame
+	}
+
+	h.typ = frame[1]
+	h.flags = binary.BigEndian.Uint16(frame[2:])
+	h.streamID = binary.BigEndian.Uint32(frame[4:])
+	h.length = binary.BigEndian.Uint32(frame[8:])
+	payload = frame[headerSize:]
+	if typeData == h.typ && int(h.length) != len(payload) {
+		return h, nil, errBadFrame
+	}
+	return h, payload, nil
+}
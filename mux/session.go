@@ -0,0 +1,264 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mux multiplexes the net.Conn like streams over a nettyws connection, like yamux.
+//
+// Every frame is a binary message, the Websocket must use nettyws.WithBinary. The streams
+// opened by the client have odd ids and the ones opened by the server have even ids. Each
+// stream has a receive window, the sender blocks until the receiver reads and updates the
+// window. CloseWrite half-closes the stream, the peer reads io.EOF after the buffered data.
+package mux
+
+import (
+	"errors"
+	"sync"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+var (
+	// ErrSessionClosed is returned when the session is closed.
+	ErrSessionClosed = errors.New("mux: session closed")
+	// ErrStreamReset is returned when the stream is reset by the peer.
+	ErrStreamReset = errors.New("mux: stream reset")
+	// ErrStreamClosed is returned when writing to the closed stream.
+	ErrStreamClosed = errors.New("mux: stream closed")
+)
+
+// the pending streams waiting for Accept
+const acceptBacklog = 256
+
+// Session multiplexes the streams over a connection.
+type Session struct {
+	conn    nettyws.Conn
+	mutex   sync.Mutex
+	nextID  uint32
+	streams map[uint32]*Stream
+	accept  chan *Stream
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// NewSession create the session of the connection, the frames received by the connection must be passed to Feed.
+func NewSession(conn nettyws.Conn, client bool) *Session {
+	s := &Session{
+		conn:    conn,
+		nextID:  2,
+		streams: make(map[uint32]*Stream),
+		accept:  make(chan *Stream, acceptBacklog),
+		closed:  make(chan struct{}),
+	}
+	if client {
+		s.nextID = 1
+	}
+	return s
+}
+
+// Bind creates the sessions of the Websocket connections by the callbacks of Websocket.UseOpen and
+// Websocket.UseClose, the OnData callback is replaced. The client is true for the connections of Websocket.Open.
+func Bind(ws *nettyws.Websocket, client bool, onSession func(session *Session)) {
+	var sessions sync.Map // map<nettyws.Conn, *Session> by the conn unwrapped from the middlewares
+
+	ws.UseOpen(func(conn nettyws.Conn) {
+		session := NewSession(conn, client)
+		sessions.Store(nettyws.Unwrap(conn), session)
+		if nil != onSession {
+			onSession(session)
+		}
+	})
+	ws.OnData = func(conn nettyws.Conn, data []byte) {
+		if session, ok := sessions.Load(nettyws.Unwrap(conn)); ok {
+			if err := session.(*Session).Feed(data); nil != err {
+				_ = conn.Close()
+			}
+		}
+	}
+	ws.UseClose(func(conn nettyws.Conn, err error) {
+		if session, ok := sessions.LoadAndDelete(nettyws.Unwrap(conn)); ok {
+			session.(*Session).shutdown()
+		}
+	})
+}
+
+// Conn returns the connection of the session.
+func (s *Session) Conn() nettyws.Conn {
+	return s.conn
+}
+
+// Open opens a new stream.
+func (s *Session) Open() (*Stream, error) {
+	s.mutex.Lock()
+	if s.isClosed() {
+		s.mutex.Unlock()
+		return nil, ErrSessionClosed
+	}
+	id := s.nextID
+	s.nextID += 2
+	stream := newStream(s, id)
+	s.streams[id] = stream
+	s.mutex.Unlock()
+
+	if err := s.writeFrame(header{typ: typeWindowUpdate, flags: flagSYN, streamID: id}, nil); nil != err {
+		s.remove(id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Accept waits the stream opened by the peer.
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case stream := <-s.accept:
+		return stream, nil
+	case <-s.closed:
+		return nil, ErrSessionClosed
+	}
+}
+
+// NumStreams returns the number of the active streams.
+func (s *Session) NumStreams() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.streams)
+}
+
+// Close sends the go away frame and closes the session, the streams are reset.
+func (s *Session) Close() error {
+	err := s.writeFrame(header{typ: typeGoAway}, nil)
+	s.shutdown()
+	return err
+}
+
+// Closed returns a channel closed when the session is closed.
+func (s *Session) Closed() <-chan struct{} {
+	return s.closed
+}
+
+// Feed handles the frame received by the connection.
+func (s *Session) Feed(frame []byte) error {
+	h, payload, err := decodeFrame(frame)
+	if nil != err {
+		return err
+	}
+
+	if typeGoAway == h.typ {
+		s.shutdown()
+		return nil
+	}
+
+	stream := s.stream(h)
+	if nil == stream {
+		return nil
+	}
+
+	switch h.typ {
+	case typeData:
+		if !stream.receive(payload) {
+			// the peer exceeds the receive window
+			stream.reset(true)
+			return nil
+		}
+	case typeWindowUpdate:
+		stream.grant(h.length)
+	}
+
+	if 0 != h.flags&flagRST {
+		stream.reset(false)
+	} else if 0 != h.flags&flagFIN {
+		stream.remoteClose()
+	}
+	return nil
+}
+
+// stream returns the stream of the frame, the stream opened by the peer is created on SYN.
+// The SYN of the stream id with the parity of the local streams is reset.
+func (s *Session) stream(h header) *Stream {
+	s.mutex.Lock()
+	if 0 != h.flags&flagSYN && (0 == h.streamID || h.streamID%2 == s.nextID%2) {
+		s.mutex.Unlock()
+		if 0 == h.flags&flagRST {
+			_ = s.writeFrame(header{typ: typeWindowUpdate, flags: flagRST, streamID: h.streamID}, nil)
+		}
+		return nil
+	}
+
+	stream, ok := s.streams[h.streamID]
+	if ok || 0 == h.flags&flagSYN || s.isClosed() {
+		s.mutex.Unlock()
+		if !ok && typeData == h.typ && 0 == h.flags&flagRST {
+			// the data of the unknown stream is reset
+			_ = s.writeFrame(header{typ: typeWindowUpdate, flags: flagRST, streamID: h.streamID}, nil)
+		}
+		return stream
+	}
+
+	stream = newStream(s, h.streamID)
+	s.streams[h.streamID] = stream
+	s.mutex.Unlock()
+
+	select {
+	case s.accept <- stream:
+		_ = s.writeFrame(header{typ: typeWindowUpdate, flags: flagACK, streamID: h.streamID}, nil)
+		return stream
+	default:
+		// the accept backlog is full
+		stream.reset(true)
+		return nil
+	}
+}
+
+// writeFrame writes the frame to the connection.
+func (s *Session) writeFrame(h header, payload []byte) error {
+	if s.isClosed() {
+		return ErrSessionClosed
+	}
+	if typeData == h.typ {
+		h.length = uint32(len(payload))
+	}
+	return s.conn.Write(encodeFrame(h, payload))
+}
+
+// remove removes the closed stream.
+func (s *Session) remove(id uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.streams, id)
+}
+
+func (s *Session) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown closes the session and resets the streams.
+func (s *Session) shutdown() {
+	s.once.Do(func() {
+		close(s.closed)
+
+		s.mutex.Lock()
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.mutex.Unlock()
+
+		for _, stream := range streams {
+			stream.reset(false)
+		}
+	})
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+// newPipe feeds the written frames in order to the session of the remote side.
+func newPipe() (client, server *Session) {
+	connA, connB := wstest.NewConn("client"), wstest.NewConn("server")
+	client, server = NewSession(connA, true), NewSession(connB, false)
+	for _, pipe := range []struct {
+		conn   *wstest.Conn
+		remote *Session
+	}{{connA, server}, {connB, client}} {
+		frames, remote := make(chan []byte, 1024), pipe.remote
+		pipe.conn.OnWrite = func(data []byte) error {
+			frames <- data
+			return nil
+		}
+		go func() {
+			for frame := range frames {
+				_ = remote.Feed(frame)
+			}
+		}()
+	}
+	return client, server
+}
+
+// headers decodes the headers of the written frames.
+func headers(conn *wstest.Conn) []header {
+	var written []header
+	for _, data := range conn.Written() {
+		h, _, _ := decodeFrame(data)
+		written = append(written, h)
+	}
+	return written
+}
+
+func TestFrame(t *testing.T) {
+	var cases = []struct {
+		h       header
+		payload []byte
+	}{
+		{header{typ: typeData, streamID: 1, length: 5}, []byte("hello")},
+		{header{typ: typeWindowUpdate, flags: flagSYN | flagACK, streamID: 2, length: initialWindow}, nil},
+		{header{typ: typeGoAway}, nil},
+	}
+
+	for _, c := range cases {
+		h, payload, err := decodeFrame(encodeFrame(c.h, c.payload))
+		if nil != err || c.h != h || !bytes.Equal(c.payload, payload) {
+			t.Fatalf("frame %+v: %+v %q %v", c.h, h, payload, err)
+		}
+	}
+
+	bad := encodeFrame(header{typ: typeData, streamID: 1, length: 9}, []byte("hello"))
+	for _, frame := range [][]byte{nil, bad, {1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}} {
+		if _, _, err := decodeFrame(frame); nil == err {
+			t.Fatalf("bad frame %v accepted", frame)
+		}
+	}
+}
+
+func TestSynParity(t *testing.T) {
+	var cases = []struct {
+		client   bool
+		streamID uint32
+		accepted bool
+	}{
+		{false, 1, true},
+		{false, 2, false},
+		{false, 0, false},
+		{true, 2, true},
+		{true, 3, false},
+	}
+
+	for _, c := range cases {
+		conn := wstest.NewConn("session")
+		s := NewSession(conn, c.client)
+		if err := s.Feed(encodeFrame(header{typ: typeWindowUpdate, flags: flagSYN, streamID: c.streamID}, nil)); nil != err {
+			t.Fatal(err)
+		}
+
+		if accepted := 1 == s.NumStreams(); c.accepted != accepted {
+			t.Fatalf("client %v syn %d: accepted %v", c.client, c.streamID, accepted)
+		}
+		want := flagACK
+		if !c.accepted {
+			want = flagRST
+		}
+		if written := headers(conn); 1 != len(written) || want != written[0].flags || c.streamID != written[0].streamID {
+			t.Fatalf("client %v syn %d: written %+v", c.client, c.streamID, written)
+		}
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	client, server := newPipe()
+	defer client.Close()
+
+	stream, err := client.Open()
+	if nil != err {
+		t.Fatal(err)
+	}
+	accepted, err := server.Accept()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), initialWindow/8)
+	written := make(chan error, 1)
+	go func() {
+		_, err := stream.Write(data)
+		written <- err
+	}()
+
+	// the writer blocks after the window is used up
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		accepted.mutex.Lock()
+		buffered := accepted.recvBuf.Len()
+		accepted.mutex.Unlock()
+		if initialWindow == buffered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-written:
+		t.Fatalf("write beyond the window: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	received := make([]byte, len(data))
+	if _, err := io.ReadFull(accepted, received); nil != err {
+		t.Fatal(err)
+	}
+	if err := <-written; nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, received) {
+		t.Fatal("received data mismatch")
+	}
+}
+
+func TestWindowExceeded(t *testing.T) {
+	conn := wstest.NewConn("session")
+	s := NewSession(conn, false)
+	_ = s.Feed(encodeFrame(header{typ: typeWindowUpdate, flags: flagSYN, streamID: 1}, nil))
+	stream, _ := s.Accept()
+
+	// the data beyond the receive window resets the stream
+	payload := make([]byte, initialWindow+1)
+	if err := s.Feed(encodeFrame(header{typ: typeData, streamID: 1, length: uint32(len(payload))}, payload)); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := stream.Read(make([]byte, 1)); ErrStreamReset != err {
+		t.Fatalf("read: %v, want ErrStreamReset", err)
+	}
+	if written := headers(conn); 0 != s.NumStreams() || flagRST != written[len(written)-1].flags {
+		t.Fatalf("streams %d, written %+v", s.NumStreams(), written)
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	server := nettyws.NewWebsocket(nettyws.WithBinary())
+	// the middleware passes a wrapped conn to OnData
+	server.Use(func(next nettyws.Handler) nettyws.Handler {
+		return func(conn nettyws.Conn, data []byte) {
+			next(&wrapConn{Conn: conn}, data)
+		}
+	})
+	Bind(server, false, func(session *Session) {
+		go func() {
+			for {
+				stream, err := session.Accept()
+				if nil != err {
+					return
+				}
+				go func() {
+					_, _ = io.Copy(stream, stream)
+					_ = stream.Close()
+				}()
+			}
+		}()
+	})
+
+	sessions := make(chan *Session, 1)
+	client := nettyws.NewWebsocket(nettyws.WithBinary())
+	Bind(client, true, func(session *Session) {
+		sessions <- session
+	})
+	wstest.Open(t, client, wstest.Serve(t, server))
+	session := wstest.Receive(t, sessions)
+
+	for _, message := range []string{"hello", "world"} {
+		stream, err := session.Open()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if _, err := stream.Write([]byte(message)); nil != err {
+			t.Fatal(err)
+		}
+		echo := make([]byte, len(message))
+		if _, err := io.ReadFull(stream, echo); nil != err || message != string(echo) {
+			t.Fatalf("echo %q, %v", echo, err)
+		}
+		_ = stream.Close()
+	}
+
+	// the session is shut down with the connection
+	_ = session.Conn().Close()
+	wstest.Receive(t, session.Closed())
+}
+
+// wrapConn is the conn passed by a middleware.
+type wrapConn struct {
+	nettyws.Conn
+}
+
+func (c *wrapConn) Unwrap() nettyws.Conn {
+	return c.Conn
+}
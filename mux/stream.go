@@ -0,0 +1,323 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stream is a multiplexed stream implements net.Conn.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mutex         sync.Mutex
+	recvBuf       bytes.Buffer
+	recvWindow    uint32
+	consumed      uint32
+	sendWindow    uint32
+	localFin      bool
+	discard       bool
+	remoteFin     bool
+	resetErr      error
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readNotify    chan struct{}
+	writeNotify   chan struct{}
+}
+
+func newStream(session *Session, id uint32) *Stream {
+	return &Stream{
+		id:          id,
+		session:     session,
+		recvWindow:  initialWindow,
+		sendWindow:  initialWindow,
+		readNotify:  make(chan struct{}, 1),
+		writeNotify: make(chan struct{}, 1),
+	}
+}
+
+// ID returns the stream id.
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+// Read reads the data of the stream, io.EOF returned after the peer half-closed the stream.
+func (s *Stream) Read(b []byte) (n int, err error) {
+	for {
+		s.mutex.Lock()
+		switch {
+		case s.recvBuf.Len() > 0:
+			n, _ = s.recvBuf.Read(b)
+			delta := s.consume(n)
+			s.mutex.Unlock()
+			if delta > 0 {
+				_ = s.session.writeFrame(header{typ: typeWindowUpdate, streamID: s.id, length: delta}, nil)
+			}
+			return n, nil
+		case nil != s.resetErr:
+			err = s.resetErr
+		case s.remoteFin:
+			err = io.EOF
+		}
+		deadline := s.readDeadline
+		s.mutex.Unlock()
+
+		if nil != err {
+			return 0, err
+		}
+		if err = wait(s.readNotify, deadline, s.session.closed); nil != err {
+			return 0, err
+		}
+	}
+}
+
+// consume returns the window delta to update after half of the window is read.
+func (s *Stream) consume(n int) uint32 {
+	s.consumed += uint32(n)
+	if s.consumed < initialWindow/2 {
+		return 0
+	}
+	delta := s.consumed
+	s.recvWindow += delta
+	s.consumed = 0
+	return delta
+}
+
+// Write writes the data to the stream, blocks until the peer has the window.
+func (s *Stream) Write(b []byte) (n int, err error) {
+	for n < len(b) {
+		s.mutex.Lock()
+		switch {
+		case nil != s.resetErr:
+			err = s.resetErr
+		case s.localFin:
+			err = ErrStreamClosed
+		}
+
+		size := 0
+		if nil == err && s.sendWindow > 0 {
+			size = min(len(b)-n, int(s.sendWindow), maxPayload)
+			s.sendWindow -= uint32(size)
+		}
+		deadline := s.writeDeadline
+		s.mutex.Unlock()
+
+		if nil != err {
+			return n, err
+		}
+
+		if 0 == size {
+			if err = wait(s.writeNotify, deadline, s.session.closed); nil != err {
+				return n, err
+			}
+			continue
+		}
+
+		if err = s.session.writeFrame(header{typ: typeData, streamID: s.id}, b[n:n+size]); nil != err {
+			return n, err
+		}
+		n += size
+	}
+	return n, nil
+}
+
+// CloseWrite half-closes the stream, the peer reads io.EOF after the written data.
+func (s *Stream) CloseWrite() error {
+	s.mutex.Lock()
+	if s.localFin || nil != s.resetErr {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.localFin = true
+	closed := s.remoteFin
+	s.mutex.Unlock()
+
+	err := s.session.writeFrame(header{typ: typeWindowUpdate, flags: flagFIN, streamID: s.id}, nil)
+	if closed {
+		s.session.remove(s.id)
+	}
+	return err
+}
+
+// Close half-closes the stream and discards the unread and incoming data, the stream is removed after the peer closes.
+func (s *Stream) Close() error {
+	s.mutex.Lock()
+	delta := s.consume(s.recvBuf.Len())
+	s.recvBuf.Reset()
+	s.discard = true
+	s.mutex.Unlock()
+
+	if delta > 0 {
+		_ = s.session.writeFrame(header{typ: typeWindowUpdate, streamID: s.id, length: delta}, nil)
+	}
+	return s.CloseWrite()
+}
+
+// Reset aborts the stream on both sides.
+func (s *Stream) Reset() error {
+	s.reset(true)
+	return nil
+}
+
+// LocalAddr returns the local address of the connection.
+func (s *Stream) LocalAddr() net.Addr {
+	return addr(s.session.conn.LocalAddr())
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (s *Stream) RemoteAddr() net.Addr {
+	return addr(s.session.conn.RemoteAddr())
+}
+
+// SetDeadline sets the read and write deadlines.
+func (s *Stream) SetDeadline(t time.Time) error {
+	_ = s.SetReadDeadline(t)
+	return s.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of the blocked and future Read calls.
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.readDeadline = t
+	s.mutex.Unlock()
+	notify(s.readNotify)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the blocked and future Write calls.
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.writeDeadline = t
+	s.mutex.Unlock()
+	notify(s.writeNotify)
+	return nil
+}
+
+// receive buffers the data, false returned if the data exceeds the receive window.
+// The data of the closed stream is discarded and the window is updated.
+func (s *Stream) receive(data []byte) bool {
+	s.mutex.Lock()
+	if uint32(len(data)) > s.recvWindow {
+		s.mutex.Unlock()
+		return false
+	}
+	s.recvWindow -= uint32(len(data))
+
+	if s.discard {
+		delta := s.consume(len(data))
+		s.mutex.Unlock()
+		if delta > 0 {
+			_ = s.session.writeFrame(header{typ: typeWindowUpdate, streamID: s.id, length: delta}, nil)
+		}
+		return true
+	}
+
+	s.recvBuf.Write(data)
+	s.mutex.Unlock()
+	notify(s.readNotify)
+	return true
+}
+
+// grant increases the send window.
+func (s *Stream) grant(delta uint32) {
+	if 0 == delta {
+		return
+	}
+	s.mutex.Lock()
+	s.sendWindow += delta
+	s.mutex.Unlock()
+	notify(s.writeNotify)
+}
+
+// remoteClose handles the FIN of the peer.
+func (s *Stream) remoteClose() {
+	s.mutex.Lock()
+	s.remoteFin = true
+	closed := s.localFin
+	s.mutex.Unlock()
+
+	notify(s.readNotify)
+	if closed {
+		s.session.remove(s.id)
+	}
+}
+
+// reset aborts the stream, the RST is sent to the peer if local.
+func (s *Stream) reset(local bool) {
+	s.mutex.Lock()
+	if nil != s.resetErr {
+		s.mutex.Unlock()
+		return
+	}
+	s.resetErr = ErrStreamReset
+	s.mutex.Unlock()
+
+	notify(s.readNotify)
+	notify(s.writeNotify)
+	s.session.remove(s.id)
+	if local {
+		_ = s.session.writeFrame(header{typ: typeWindowUpdate, flags: flagRST, streamID: s.id}, nil)
+	}
+}
+
+// notify wakes up the waiting call.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits the notification, os.ErrDeadlineExceeded returned if the deadline passed.
+func wait(ch chan struct{}, deadline time.Time, closed chan struct{}) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-closed:
+		return ErrSessionClosed
+	}
+}
+
+// addr is the network address of the connection.
+type addr string
+
+func (a addr) Network() string {
+	return "websocket"
+}
+
+func (a addr) String() string {
+	return string(a)
+}
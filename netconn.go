@@ -0,0 +1,270 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// the buffered bytes of NetConn before the read loop blocks
+const netConnBufferSize = 4 << 20
+
+var (
+	// ErrNotNettyConn is returned by NetConn if the connection is not created by nettyws,
+	// the conn wrapper must implement Unwrapper.
+	ErrNotNettyConn = errors.New("nettyws: NetConn requires the connection of nettyws")
+	// ErrMessageType is returned by NetConn if the message type mismatches the Websocket.
+	ErrMessageType = errors.New("nettyws: NetConn message type mismatch")
+)
+
+// netAddr is the address of the websocket connection.
+type netAddr string
+
+func (a netAddr) Network() string {
+	return "websocket"
+}
+
+func (a netAddr) String() string {
+	return string(a)
+}
+
+// netConn is the net.Conn of a websocket connection.
+type netConn struct {
+	conn      *wsConn
+	mutex     sync.Mutex
+	buffer    bytes.Buffer
+	err       error
+	deadline  time.Time
+	readable  chan struct{}
+	drained   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	onClose   func()
+}
+
+// NetConn returns the net.Conn of the connection, the reads span the message boundaries and
+// every write is a message. The messageType must be the message type of the Websocket, see WithBinary.
+// The messages are read by the net.Conn instead of OnData, call NetConn in OnOpen to read all the messages.
+// The read deadline applies to the buffered messages, the write deadline applies to the connection
+// and to the write queue of WithAsyncWrite, see Conn.SetWriteDeadline.
+func NetConn(conn Conn, messageType MessageType) (net.Conn, error) {
+	c := unwrapConn(conn)
+	if nil == c {
+		return nil, ErrNotNettyConn
+	}
+	if messageType != c.ws.opts.messageType {
+		return nil, ErrMessageType
+	}
+
+	nc := &netConn{
+		conn:     c,
+		readable: make(chan struct{}, 1),
+		drained:  make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	c.sink.Store(nc)
+	return nc, nil
+}
+
+// DialNetConn opens the websocket connection to the address with options and returns the net.Conn
+// of binary messages, the Websocket is closed with the net.Conn. The messages are always binary,
+// the message type of WithCodec is overridden.
+func DialNetConn(ctx context.Context, addr string, options ...Option) (net.Conn, error) {
+	ws := NewWebsocket(append(options[:len(options):len(options)], WithBinary())...)
+
+	var nc *netConn
+	var ncErr error
+	ws.OnOpen = func(conn Conn) {
+		c, err := NetConn(conn, MsgBinary)
+		if nil != err {
+			ncErr = err
+			_ = conn.Close()
+			return
+		}
+		nc = c.(*netConn)
+		nc.onClose = func() { _ = ws.Close() }
+	}
+
+	type result struct {
+		conn Conn
+		err  error
+	}
+	opened := make(chan result, 1)
+	go func() {
+		conn, err := ws.Open(addr)
+		opened <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-opened:
+		if nil == r.err && nil == nc {
+			r.err = ncErr
+		}
+		if nil != r.err {
+			_ = ws.Close()
+			return nil, r.err
+		}
+		return nc, nil
+	case <-ctx.Done():
+		// the dial is canceled with the Websocket
+		_ = ws.Close()
+		if r := <-opened; nil != r.conn {
+			_ = r.conn.Close()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// push buffers the message, the read loop blocks while the buffer is full.
+func (nc *netConn) push(data []byte) {
+	for {
+		nc.mutex.Lock()
+		if nc.buffer.Len() < netConnBufferSize {
+			nc.buffer.Write(data)
+			nc.mutex.Unlock()
+			notify(nc.readable)
+			return
+		}
+		nc.mutex.Unlock()
+
+		select {
+		case <-nc.drained:
+		case <-nc.closed:
+			return
+		}
+	}
+}
+
+// closeRead ends the reads after the buffered messages.
+func (nc *netConn) closeRead(err error) {
+	var closedErr ClosedError
+	if nil == err || (errors.As(err, &closedErr) && 1000 == closedErr.Code) {
+		err = io.EOF
+	}
+
+	nc.mutex.Lock()
+	if nil == nc.err {
+		nc.err = err
+	}
+	nc.mutex.Unlock()
+	notify(nc.readable)
+}
+
+func (nc *netConn) Read(b []byte) (int, error) {
+	for {
+		nc.mutex.Lock()
+		if nc.buffer.Len() > 0 {
+			n, _ := nc.buffer.Read(b)
+			nc.mutex.Unlock()
+			notify(nc.drained)
+			return n, nil
+		}
+		err, deadline := nc.err, nc.deadline
+		nc.mutex.Unlock()
+
+		if nil != err {
+			return 0, err
+		}
+
+		if err = nc.wait(deadline); nil != err {
+			return 0, err
+		}
+	}
+}
+
+// wait waits the readable notification until the deadline.
+func (nc *netConn) wait(deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-nc.readable:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-nc.closed:
+		return net.ErrClosed
+	}
+}
+
+func (nc *netConn) Write(b []byte) (int, error) {
+	if err := nc.conn.Write(b); nil != err {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (nc *netConn) Close() error {
+	nc.closeOnce.Do(func() {
+		close(nc.closed)
+		_ = nc.conn.Close()
+		if nil != nc.onClose {
+			nc.onClose()
+		}
+	})
+	return nil
+}
+
+func (nc *netConn) LocalAddr() net.Addr {
+	return netAddr(nc.conn.LocalAddr())
+}
+
+func (nc *netConn) RemoteAddr() net.Addr {
+	return netAddr(nc.conn.RemoteAddr())
+}
+
+func (nc *netConn) SetDeadline(t time.Time) error {
+	_ = nc.SetReadDeadline(t)
+	return nc.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of waiting the messages, the read loop of the connection is not affected.
+func (nc *netConn) SetReadDeadline(t time.Time) error {
+	nc.mutex.Lock()
+	nc.deadline = t
+	nc.mutex.Unlock()
+	notify(nc.readable)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of the connection and its write queue.
+func (nc *netConn) SetWriteDeadline(t time.Time) error {
+	return nc.conn.SetWriteDeadline(t)
+}
+
+// notify wakes up the waiting call.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetConn(t *testing.T) {
+	var cases = []struct {
+		conn        func(c *wsConn) Conn
+		messageType MessageType
+		err         error
+	}{
+		{func(c *wsConn) Conn { return c }, MsgText, nil},
+		{func(c *wsConn) Conn { return wrappedConn{wrappedConn{c}} }, MsgText, nil},
+		{func(c *wsConn) Conn { return c }, MsgBinary, ErrMessageType},
+		{func(c *wsConn) Conn { return opaqueConn{c} }, MsgText, ErrNotNettyConn},
+	}
+
+	for i, c := range cases {
+		conn := &wsConn{ws: NewWebsocket()}
+		nc, err := NetConn(c.conn(conn), c.messageType)
+		if c.err != err {
+			t.Fatalf("case %d: %v, want %v", i, err, c.err)
+		}
+		if nil == err && conn.sink.Load() != nc {
+			t.Fatalf("case %d: net.Conn not attached", i)
+		}
+	}
+}
+
+func TestNetConnRead(t *testing.T) {
+	nc, err := NetConn(&wsConn{ws: NewWebsocket()}, MsgText)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// the reads span the message boundaries until the connection is closed
+	sink := nc.(*netConn)
+	sink.push([]byte("hello "))
+	sink.push([]byte("world"))
+	sink.closeRead(nil)
+
+	data, err := io.ReadAll(nc)
+	if nil != err || "hello world" != string(data) {
+		t.Fatalf("read: %q %v", data, err)
+	}
+}
+
+func TestNetConnReadDeadline(t *testing.T) {
+	nc, err := NetConn(&wsConn{ws: NewWebsocket()}, MsgText)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// the blocked read times out, the expired deadline fails immediately
+	_ = nc.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, 16)
+	for i := 0; i < 2; i++ {
+		if n, err := nc.Read(buf); 0 != n || !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("read %d: %d %v, want deadline exceeded", i, n, err)
+		}
+	}
+
+	// the buffered message is read after the deadline is cleared
+	_ = nc.SetReadDeadline(time.Time{})
+	nc.(*netConn).push([]byte("hello"))
+	if n, err := nc.Read(buf); nil != err || "hello" != string(buf[:n]) {
+		t.Fatalf("read: %q %v", buf[:n], err)
+	}
+}
+
+func TestNetConnBackpressure(t *testing.T) {
+	nc, err := NetConn(&wsConn{ws: NewWebsocket()}, MsgText)
+	if nil != err {
+		t.Fatal(err)
+	}
+	sink := nc.(*netConn)
+
+	// the push blocks while the buffer is full
+	sink.push(make([]byte, netConnBufferSize))
+	pushed := make(chan struct{})
+	go func() {
+		sink.push([]byte("hello"))
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push to the full buffer is not blocked")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the read drains the buffer and wakes up the push
+	if _, err = nc.Read(make([]byte, 1024)); nil != err {
+		t.Fatal(err)
+	}
+	receiveTest(t, pushed)
+	if size := sink.buffer.Len(); netConnBufferSize-1024+5 != size {
+		t.Fatalf("buffered %d bytes", size)
+	}
+}
+
+func TestNetConnClose(t *testing.T) {
+	server := NewWebsocket(WithBinary())
+	accepted := make(chan net.Conn, 1)
+	server.OnOpen = func(conn Conn) {
+		nc, _ := NetConn(conn, MsgBinary)
+		accepted <- nc
+	}
+	url := serveTest(t, server)
+
+	client, err := DialNetConn(context.Background(), url)
+	if nil != err {
+		t.Fatal(err)
+	}
+	nc := receiveTest(t, accepted)
+
+	// Close wakes up the blocked read
+	read := make(chan error, 1)
+	go func() {
+		_, err := client.Read(make([]byte, 16))
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		t.Fatalf("read without messages returns %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	_ = client.Close()
+	if err := receiveTest(t, read); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("read after Close: %v, want net.ErrClosed", err)
+	}
+
+	// Close wakes up the blocked push of the read loop
+	sink := nc.(*netConn)
+	sink.push(make([]byte, netConnBufferSize))
+	pushed := make(chan struct{})
+	go func() {
+		sink.push([]byte("hello"))
+		close(pushed)
+	}()
+	_ = nc.Close()
+	receiveTest(t, pushed)
+}
+
+func TestNetConnWriteDeadline(t *testing.T) {
+	server := NewWebsocket(WithBinary())
+	url := serveTest(t, server)
+
+	client, err := DialNetConn(context.Background(), url, WithAsyncWrite(1, false))
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	// the expired write deadline fails the write to the queue
+	_ = client.SetWriteDeadline(time.Now().Add(-time.Second))
+	if n, err := client.Write([]byte("hello")); 0 != n || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("write: %d %v, want deadline exceeded", n, err)
+	}
+	_ = client.SetWriteDeadline(time.Time{})
+	if _, err := client.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestDialNetConnCancel(t *testing.T) {
+	// the handshake never completes
+	stall := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stall
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stall) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	dialed := make(chan error, 1)
+	go func() {
+		nc, err := DialNetConn(ctx, "ws"+strings.TrimPrefix(server.URL, "http"))
+		if nil != nc {
+			_ = nc.Close()
+		}
+		dialed <- err
+	}()
+	if err := receiveTest(t, dialed); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("dial: %v, want deadline exceeded", err)
+	}
+}
+
+func TestDialNetConnCodec(t *testing.T) {
+	server := NewWebsocket(WithBinary())
+	received := make(chan []byte, 1)
+	server.OnData = func(conn Conn, data []byte) {
+		received <- data
+	}
+	url := serveTest(t, server)
+
+	// the text codec does not change the binary messages of the net.Conn
+	client, err := DialNetConn(context.Background(), url, WithCodec(JSON))
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	if _, err := client.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+	if data := receiveTest(t, received); "hello" != string(data) {
+		t.Fatalf("received %q", data)
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"sync"
 
@@ -31,19 +33,51 @@ import (
 type OnOpenFunc func(conn Conn)
 type OnDataFunc func(conn Conn, data []byte)
 type OnCloseFunc func(conn Conn, err error)
+type OnSlowConsumerFunc func(conn Conn)
 
 type Websocket struct {
 	engine    netty.Bootstrap
 	holder    netty.ChannelHolder
 	options   *websocket.Options
+	opts      *options
 	ctx       context.Context
 	cancel    context.CancelFunc
-	listeners sync.Map // map<url , netty.Listener>
+	closeOnce sync.Once
+	listeners sync.Map // map<url , *http.Server>
+	paths     sync.Map // map<path, struct{}> registered on the ServeMux
 	upgrader  websocket.HTTPUpgrader
+	// limit the new handshakes per second
+	handshakes *tokenBucket
+	// limit the server connections
+	connections *connLimiter
+	proxies     trustedProxies
+	metrics     Metrics
+	tracer      Tracer
+	// the total depth of the write queues
+	queueDepthMutex sync.Mutex
+	queueDepth      int
+	// the inbound and outbound middlewares
+	middlewares      []Middleware
+	inbound          Handler
+	writeMiddlewares []WriteMiddleware
+	openCallbacks    []OnOpenFunc
+	closeCallbacks   []OnCloseFunc
+	// the connections of the users
+	usersMutex sync.RWMutex
+	users      map[string]map[*wsConn]struct{}
+	// the presence changes waiting for OnPresenceChange
+	presences        []presence
+	presenceDraining bool
 
 	OnOpen  OnOpenFunc
 	OnData  OnDataFunc
 	OnClose OnCloseFunc
+	// OnSlowConsumer is called when the async write queue of the connection is full.
+	OnSlowConsumer OnSlowConsumerFunc
+	// OnPresenceChange is called when the user goes online or offline, see WithUserKey.
+	// The changes are notified in order outside the locks, maybe on the goroutine of another connection,
+	// the panic of OnPresenceChange is logged and does not stop the remaining changes.
+	OnPresenceChange OnPresenceChangeFunc
 }
 
 // NewWebsocket create websocket instance with options
@@ -51,17 +85,55 @@ func NewWebsocket(options ...Option) *Websocket {
 	opts := parseOptions(options...)
 
 	ws := &Websocket{}
-	ws.engine = opts.engine
+	ws.engine = opts.engine.bootstrap
 	ws.holder = newChannelHolder(1024)
 	ws.options = opts.wsOptions()
-	ws.ctx, ws.cancel = context.WithCancel(opts.engine.Context())
-	ws.upgrader = websocket.NewHTTPUpgrader(opts.engine, transport.WithAttachment(ws), transport.WithContext(ws.ctx), websocket.WithOptions(ws.options))
+	ws.opts = opts
+	if ws.wireEnabled() {
+		ws.wireDialer()
+	}
+	ws.handshakes = newTokenBucket(opts.handshakeRate)
+	ws.connections = newConnLimiter(opts.maxConnections, opts.maxConnsPerIP)
+	ws.proxies = opts.trustedProxies
+	ws.users = make(map[string]map[*wsConn]struct{})
+	ws.metrics = opts.metrics
+	if nil == ws.metrics {
+		ws.metrics = nopMetrics{}
+	}
+	if ws.tracer = opts.tracer; nil != ws.tracer {
+		ws.traceDialer()
+	}
+	ws.ctx, ws.cancel = context.WithCancel(ws.engine.Context())
+	// the shutdown of the engine closes the Websocket
+	context.AfterFunc(ws.ctx, ws.shutdown)
+	ws.upgrader = websocket.NewHTTPUpgrader(ws.engine, transport.WithAttachment(ws), transport.WithContext(ws.ctx), websocket.WithOptions(ws.options))
 	return ws
 }
 
 // Open websocket connection from address
 func (ws *Websocket) Open(addr string) (conn Conn, err error) {
-	channel, err := ws.engine.Connect(addr, transport.WithAttachment(ws), transport.WithContext(ws.ctx), websocket.WithOptions(ws.options))
+	if nil != ws.opts.err {
+		return nil, ws.opts.err
+	}
+
+	ctx := ws.ctx
+	if nil != ws.tracer {
+		var trace *openTrace
+		ctx, trace = startOpen(ws.tracer, ctx, addr)
+		defer func() { trace.finish(err) }()
+	}
+
+	if ws.wireEnabled() {
+		ctx = context.WithValue(ctx, wireSlotKey{}, &wireSlot{})
+	}
+
+	defer func() {
+		if nil != err {
+			ws.log(ctx, slog.LevelInfo, "websocket open failed", slog.String("url", addr), slog.String("error", err.Error()))
+		}
+	}()
+
+	channel, err := ws.engine.Connect(addr, transport.WithAttachment(ws), transport.WithContext(ctx), websocket.WithOptions(ws.options))
 	if nil == err {
 		channel.Pipeline().IndexOf(func(handler netty.Handler) bool {
 			var ok bool
@@ -78,49 +150,123 @@ func (ws *Websocket) Open(addr string) (conn Conn, err error) {
 	return conn, err
 }
 
-// Listen websocket connections on address
+// Listen websocket connections on address, the connections are served by a net/http server with the
+// ServeMux, the path of address is registered on the ServeMux to upgrade the requests on that exact path.
+// The listen backlog is the default of the system.
+// The wss scheme requires WithServeTLS and the ws scheme must not be used with it.
 func (ws *Websocket) Listen(addr string) error {
-	// create listener
-	listener := ws.engine.Listen(addr, transport.WithAttachment(ws), transport.WithContext(ws.ctx), websocket.WithOptions(ws.options))
-	ws.listeners.Store(addr, listener)
+	if nil != ws.opts.err {
+		return ws.opts.err
+	}
+
+	options, err := transport.ParseOptions(ws.ctx, addr)
+	if nil != err {
+		return err
+	}
+
+	switch scheme := options.Address.Scheme; {
+	case ("wss" == scheme || "https" == scheme) && nil == ws.opts.tls:
+		return fmt.Errorf("listen %s: the %s scheme requires WithServeTLS", addr, scheme)
+	case ("ws" == scheme || "http" == scheme) && nil != ws.opts.tls:
+		return fmt.Errorf("listen %s: the %s scheme can not be served with TLS", addr, scheme)
+	}
+
+	server := &http.Server{
+		Addr:              options.Address.Host,
+		TLSConfig:         ws.opts.tls,
+		ReadHeaderTimeout: ws.opts.handshakeTimeout,
+		Handler:           ws.opts.serveMux,
+	}
+
+	if _, loaded := ws.listeners.LoadOrStore(addr, server); loaded {
+		return fmt.Errorf("duplicate listener: %s", addr)
+	}
+
+	// upgrade the requests on the exact path, the others are served by serveMux
+	path := options.Address.Path
+	if _, loaded := ws.paths.LoadOrStore(path, struct{}{}); !loaded {
+		ws.opts.serveMux.HandleFunc(path, func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path != path {
+				http.NotFound(writer, request)
+				return
+			}
+			ws.ServeHTTP(writer, request)
+		})
+	}
 
 	defer func() {
 		if _, loaded := ws.listeners.LoadAndDelete(addr); loaded {
-			_ = listener.Close()
+			_ = server.Close()
 		}
 	}()
 
-	// listen connections
-	return listener.Sync()
+	listener, err := net.Listen("tcp", server.Addr)
+	if nil != err {
+		return err
+	}
+	listener = noDelayListener{Listener: listener, noDelay: ws.opts.noDelay}
+
+	// serve connections
+	if nil != server.TLSConfig {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return ErrServerClosed
+	}
+	return err
+}
+
+// noDelayListener applies the WithNoDelay option to the accepted connections.
+type noDelayListener struct {
+	net.Listener
+	noDelay bool
+}
+
+func (l noDelayListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetNoDelay(l.noDelay)
+	}
+	return conn, err
 }
 
-// Close the listeners and connections
+// Close the listeners and connections, the engine of WithEngine is not shut down.
 func (ws *Websocket) Close() error {
 	// all child or client connections to canceled
 	ws.cancel()
+	ws.shutdown()
+	return nil
+}
 
+// shutdown close the listeners and connections once, after the Websocket is canceled.
+func (ws *Websocket) shutdown() {
+	ws.closeOnce.Do(ws.closeAll)
+}
+
+func (ws *Websocket) closeAll() {
 	// close all listeners
 	ws.listeners.Range(func(key, value interface{}) bool {
 		ws.listeners.Delete(key)
-		_ = value.(netty.Listener).Close()
+		_ = value.(*http.Server).Close()
 		return true
 	})
 
-	// close all connections
+	// close all connections, the engine is owned by the caller of NewEngine
 	ws.holder.CloseAll(ClosedError{Code: 1000, Reason: "websocket shutdown"})
-
-	// stop the custom engine
-	if defaultEngine != ws.engine {
-		ws.engine.Shutdown()
-	}
-	return nil
 }
 
 func (ws *Websocket) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	if _, err := ws.UpgradeHTTP(writer, request); nil != err {
-		if errors.Is(err, ErrServerClosed) {
+		var handshakeErr HandshakeError
+		switch {
+		case errors.As(err, &handshakeErr):
+			// response has been written by UpgradeHTTP
+		case errors.Is(err, ErrServerClosed):
 			http.Error(writer, "http: server shutdown", http.StatusNotAcceptable)
-		} else {
+		default:
 			http.Error(writer, err.Error(), http.StatusNotAcceptable)
 		}
 	}
@@ -129,14 +275,51 @@ func (ws *Websocket) ServeHTTP(writer http.ResponseWriter, request *http.Request
 // UpgradeHTTP upgrades http connection to the websocket connection
 func (ws *Websocket) UpgradeHTTP(writer http.ResponseWriter, request *http.Request) (conn Conn, err error) {
 
+	// the connection context carries the values of the span context
+	if nil != ws.tracer {
+		ctx, end := ws.tracer.Start(ws.tracer.Extract(request.Context(), request.Header), spanUpgrade,
+			slog.String("remote_addr", request.RemoteAddr), slog.String("path", request.URL.Path))
+		request = request.WithContext(ctx)
+		defer func() { end(err) }()
+	}
+
 	select {
 	case <-ws.ctx.Done():
+		ws.metrics.HandshakeRejected(rejectStatus(ErrServerClosed))
 		return nil, ErrServerClosed
 	default:
 	}
 
+	if nil != ws.opts.err {
+		return nil, ws.opts.err
+	}
+
+	// check the handshake request
+	if err = ws.acceptHandshake(request); nil != err {
+		ws.rejectHandshake(writer, request, err)
+		return nil, err
+	}
+
+	// resolve the user key of the connection
+	if request, err = ws.resolveUser(request); nil != err {
+		ws.releaseHandshake(request)
+		ws.rejectHandshake(writer, request, err)
+		return nil, err
+	}
+
+	if ws.wireEnabled() {
+		slot := &wireSlot{}
+		request = request.WithContext(context.WithValue(request.Context(), wireSlotKey{}, slot))
+		writer = &hijackWriter{ResponseWriter: writer, wrap: func(conn net.Conn) net.Conn {
+			return slot.attach(ws.newWire(conn, false))
+		}}
+	}
+
 	channel, err := ws.upgrader.Upgrade(writer, request)
 	if nil != err {
+		ws.releaseHandshake(request)
+		ws.metrics.HandshakeRejected(rejectStatus(err))
+		ws.logHandshakeError(request, err)
 		return nil, err
 	}
 
@@ -149,6 +332,45 @@ func (ws *Websocket) UpgradeHTTP(writer http.ResponseWriter, request *http.Reque
 	if nil == conn {
 		err = fmt.Errorf("not found `Conn` Handler in pipleine")
 		channel.Close(err)
+		ws.releaseHandshake(request)
+		ws.metrics.Error(err)
+		return
 	}
+
+	ws.metrics.HandshakeAccepted()
 	return
 }
+
+// acceptHandshake check the handshake request before upgrading
+func (ws *Websocket) acceptHandshake(request *http.Request) error {
+	if !ws.handshakes.allow(1) {
+		return HandshakeError{Status: http.StatusTooManyRequests, Reason: "too many handshakes", RetryAfter: ws.handshakes.retryAfter()}
+	}
+
+	if nil != ws.connections {
+		return ws.connections.acquire(ws.proxies.clientIP(request))
+	}
+	return nil
+}
+
+// rejectHandshake responds the rejected handshake request.
+func (ws *Websocket) rejectHandshake(writer http.ResponseWriter, request *http.Request, err error) {
+	var handshakeErr HandshakeError
+	if errors.As(err, &handshakeErr) {
+		handshakeErr.writeResponse(writer)
+	}
+	ws.metrics.HandshakeRejected(rejectStatus(err))
+	ws.logHandshakeError(request, err)
+}
+
+// releaseHandshake release the connection acquired by acceptHandshake
+func (ws *Websocket) releaseHandshake(request *http.Request) {
+	if nil != ws.connections {
+		ws.connections.release(ws.proxies.clientIP(request))
+	}
+}
+
+// wireEnabled reports whether the frames on the wire should be observed
+func (ws *Websocket) wireEnabled() bool {
+	return ws.opts.frameStats || nil != ws.opts.frameTrace
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTest serves the Websocket on a loopback http server, the websocket url is returned.
+func serveTest(t *testing.T, ws *Websocket) string {
+	t.Helper()
+	server := httptest.NewServer(ws)
+	t.Cleanup(func() {
+		_ = ws.Close()
+		server.Close()
+	})
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// openTest opens a client connection of the Websocket, the client is closed with the test.
+func openTest(t *testing.T, ws *Websocket, url string) Conn {
+	t.Helper()
+	conn, err := ws.Open(url)
+	if nil != err {
+		t.Fatalf("open %s: %v", url, err)
+	}
+	t.Cleanup(func() { _ = ws.Close() })
+	return conn
+}
+
+// receiveTest receives a value from the channel in a second.
+func receiveTest[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+		panic("unreachable")
+	}
+}
+
+// listenTest listens the Websocket on a free loopback port with the path, the host:port is returned.
+func listenTest(t *testing.T, ws *Websocket, path string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- ws.Listen("ws://" + addr + path) }()
+	t.Cleanup(func() {
+		_ = ws.Close()
+		if err := receiveTest(t, done); !errors.Is(err, ErrServerClosed) {
+			t.Errorf("listen returns %v", err)
+		}
+	})
+
+	// wait for the listener
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); nil == err {
+			_ = conn.Close()
+			return addr
+		} else if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListenServeMux(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		get    string
+		status int
+		body   string
+	}{
+		{name: "root handler", path: "/", get: "/health", status: http.StatusOK, body: "ok"},
+		{name: "root upgrade", path: "/", get: "/", status: http.StatusBadRequest},
+		{name: "path handler", path: "/ws", get: "/health", status: http.StatusOK, body: "ok"},
+		{name: "path upgrade", path: "/ws", get: "/ws", status: http.StatusBadRequest},
+		{name: "path exact", path: "/ws", get: "/ws/more", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serveMux := http.NewServeMux()
+			serveMux.HandleFunc("/health", func(writer http.ResponseWriter, request *http.Request) {
+				_, _ = io.WriteString(writer, "ok")
+			})
+
+			ws := NewWebsocket(WithServeMux(serveMux))
+			addr := listenTest(t, ws, tt.path)
+
+			// the plain http request is not a websocket handshake
+			response, err := http.Get("http://" + addr + tt.get)
+			if nil != err {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			_ = response.Body.Close()
+			if tt.status != response.StatusCode || ("" != tt.body && tt.body != string(body)) {
+				t.Fatalf("status %d body %q, want %d %q", response.StatusCode, body, tt.status, tt.body)
+			}
+		})
+	}
+}
+
+func TestListenUpgrade(t *testing.T) {
+	var received = make(chan string, 1)
+
+	server := NewWebsocket()
+	server.OnData = func(conn Conn, data []byte) {
+		received <- string(data)
+	}
+	addr := listenTest(t, server, "/ws")
+
+	conn := openTest(t, NewWebsocket(), "ws://"+addr+"/ws")
+	if err := conn.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+	if data := receiveTest(t, received); "hello" != data {
+		t.Fatalf("received %q", data)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	var received = make(chan string, 1)
+
+	server := NewWebsocket(WithHandshakeTimeout(100 * time.Millisecond))
+	server.OnData = func(conn Conn, data []byte) {
+		received <- string(data)
+	}
+	addr := listenTest(t, server, "/ws")
+
+	// the client never finishes the request headers
+	slow, err := net.Dial("tcp", addr)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	if _, err = io.WriteString(slow, "GET /ws HTTP/1.1\r\nHost: "+addr+"\r\n"); nil != err {
+		t.Fatal(err)
+	}
+
+	_ = slow.SetReadDeadline(time.Now().Add(time.Second))
+	start := time.Now()
+	if _, err = io.ReadAll(slow); nil != err {
+		t.Fatalf("slow handshake is not disconnected: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("slow handshake is disconnected after %v", elapsed)
+	}
+
+	// the timeout does not apply to the upgraded connection
+	conn := openTest(t, NewWebsocket(), "ws://"+addr+"/ws")
+	time.Sleep(200 * time.Millisecond)
+	if err = conn.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+	if data := receiveTest(t, received); "hello" != data {
+		t.Fatalf("received %q", data)
+	}
+}
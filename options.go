@@ -19,6 +19,9 @@ package nettyws
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"time"
@@ -50,9 +53,10 @@ type contextDialer interface {
 }
 
 type options struct {
-	engine            netty.Bootstrap
+	engine            *Engine
 	serveMux          *http.ServeMux
 	tls               *tls.Config
+	clientTLS         *tls.Config
 	noDelay           bool
 	checkUTF8         bool
 	maxFrameSize      int64
@@ -66,6 +70,35 @@ type options struct {
 	responseHeader    http.Header
 	dialer            Dialer
 	dialTimeout       time.Duration
+	writeQueueSize    int
+	writeForever      bool
+	queuePolicy       QueuePolicy
+	messageRate       int
+	byteRate          int
+	rateLimitAction   RateLimitAction
+	handshakeRate     int
+	maxConnections    int
+	maxConnsPerIP     int
+	trustedProxies    trustedProxies
+	handshakeTimeout  time.Duration
+	frameStats        bool
+	metrics           Metrics
+	tracer            Tracer
+	traceMessages     bool
+	logger            *slog.Logger
+	frameTrace        FrameTraceFunc
+	frameTracePayload int
+	pipeline          PipelineFunc
+	codec             Codec
+	userKey           UserKeyFunc
+	err               error
+}
+
+// fail records the first invalid option, it is returned by Listen, Open and UpgradeHTTP.
+func (wso *options) fail(err error) {
+	if nil == wso.err {
+		wso.err = err
+	}
 }
 
 func parseOptions(opt ...Option) *options {
@@ -76,10 +109,20 @@ func parseOptions(opt ...Option) *options {
 		noDelay:         true,
 		readBufferSize:  0,
 		writeBufferSize: 0,
+		queuePolicy:     -1,
+		codec:           JSON,
 	}
 	for _, op := range opt {
 		op(opts)
 	}
+
+	// the policy follows writeForever unless specified
+	if opts.queuePolicy < 0 {
+		opts.queuePolicy = QueueDropNewest
+		if opts.writeForever {
+			opts.queuePolicy = QueueBlock
+		}
+	}
 	return opts
 }
 
@@ -95,6 +138,8 @@ func (wso *options) wsOptions() *websocket.Options {
 		dialer.Header = ws.HandshakeHeaderHTTP(wso.requestHeader)
 	}
 
+	dialer.TLSConfig = wso.clientTLS
+
 	if wso.dialer != nil {
 		ctxDialer, isCtxDialer := wso.dialer.(contextDialer)
 		dialer.NetDial = func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -106,6 +151,7 @@ func (wso *options) wsOptions() *websocket.Options {
 	}
 
 	var upgrader = ws.DefaultHTTPUpgrader
+	upgrader.Timeout = wso.handshakeTimeout
 	if wso.responseHeader != nil {
 		upgrader.Header = wso.responseHeader
 	}
@@ -130,6 +176,9 @@ func (wso *options) wsOptions() *websocket.Options {
 
 type Option func(*options)
 
+// PipelineFunc adds the user handlers to the pipeline of the channel.
+type PipelineFunc func(channel netty.Channel, pipeline netty.Pipeline)
+
 // WithServeMux overwrite default http.ServeMux
 func WithServeMux(serveMux *http.ServeMux) Option {
 	return func(options *options) {
@@ -182,16 +231,18 @@ func WithBufferSize(readBufferSize, writeBufferSize int) Option {
 	}
 }
 
-// WithAsyncWrite enable async write
+// WithAsyncWrite enable async write, writeForever blocks the writer when the write queue is full,
+// otherwise the message will be dropped and ErrWriteQueueFull returned.
 func WithAsyncWrite(writeQueueSize int, writeForever bool) Option {
 	return func(options *options) {
-		options.engine = netty.NewBootstrap(
-			netty.WithTransport(websocket.New()),
-			netty.WithChannel(netty.NewAsyncWriteChannel(writeQueueSize, writeForever)),
-			netty.WithChannelHolder(nil),
-			netty.WithClientInitializer(makeInitializer(true)),
-			netty.WithChildInitializer(makeInitializer(false)),
-		)
+		options.writeQueueSize, options.writeForever = writeQueueSize, writeForever
+	}
+}
+
+// WithWriteQueuePolicy set the policy of async write when the write queue is full.
+func WithWriteQueuePolicy(policy QueuePolicy) Option {
+	return func(options *options) {
+		options.queuePolicy = policy
 	}
 }
 
@@ -227,6 +278,14 @@ func WithDialer(dialer Dialer) Option {
 	}
 }
 
+// WithHandshakeTimeout specify the timeout is the maximum amount of time the server will wait for
+// reading the upgrade request and writing the handshake response.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.handshakeTimeout = timeout
+	}
+}
+
 // WithDialTimeout specify the timeout is the maximum amount of time a Dial() will wait for a connect
 // and an handshake to complete.
 func WithDialTimeout(timeout time.Duration) Option {
@@ -234,3 +293,143 @@ func WithDialTimeout(timeout time.Duration) Option {
 		options.dialTimeout = timeout
 	}
 }
+
+// WithRateLimit limit the inbound messages and bytes per second of each connection,
+// zero means no limit. The action is taken when the connection exceeds the limit.
+func WithRateLimit(messagesPerSecond, bytesPerSecond int, action RateLimitAction) Option {
+	return func(options *options) {
+		options.messageRate, options.byteRate, options.rateLimitAction = messagesPerSecond, bytesPerSecond, action
+	}
+}
+
+// WithHandshakeRateLimit limit the new handshakes per second of the server,
+// exceeding handshakes will be rejected with 429 (Too Many Requests).
+func WithHandshakeRateLimit(handshakesPerSecond int) Option {
+	return func(options *options) {
+		options.handshakeRate = handshakesPerSecond
+	}
+}
+
+// WithMaxConnections limit the total server connections, exceeding handshakes
+// will be rejected with 503 (Service Unavailable).
+func WithMaxConnections(maxConnections int) Option {
+	return func(options *options) {
+		options.maxConnections = maxConnections
+	}
+}
+
+// WithMaxConnectionsPerIP limit the server connections of each remote ip, exceeding
+// handshakes will be rejected with 429 (Too Many Requests).
+func WithMaxConnectionsPerIP(maxConnections int) Option {
+	return func(options *options) {
+		options.maxConnsPerIP = maxConnections
+	}
+}
+
+// WithTrustedProxies specify the ip or cidr of the trusted proxies, the remote ip
+// of the requests from them will be taken from X-Forwarded-For or X-Real-IP header.
+// A malformed proxy is returned as error by Listen, Open and UpgradeHTTP.
+func WithTrustedProxies(proxies ...string) Option {
+	prefixes, err := parseTrustedProxies(proxies...)
+	return func(options *options) {
+		if nil != err {
+			options.fail(err)
+			return
+		}
+		options.trustedProxies = append(options.trustedProxies, prefixes...)
+	}
+}
+
+// WithFrameStats enable the frame level statistics of connections, including frames,
+// wire bytes and ping round trip time.
+func WithFrameStats() Option {
+	return func(options *options) {
+		options.frameStats = true
+	}
+}
+
+// WithMetrics specify the Metrics to receive the events of the Websocket.
+func WithMetrics(metrics Metrics) Option {
+	return func(options *options) {
+		options.metrics = metrics
+	}
+}
+
+// WithTracer specify the Tracer to trace the handshakes, traceMessages enable
+// the spans of inbound messages.
+func WithTracer(tracer Tracer, traceMessages bool) Option {
+	return func(options *options) {
+		options.tracer, options.traceMessages = tracer, traceMessages
+	}
+}
+
+// WithClientTLS specify the tls config of the wss connections opened by the client,
+// the server name defaults to the host of the url.
+func WithClientTLS(tls *tls.Config) Option {
+	return func(options *options) {
+		options.clientTLS = tls
+	}
+}
+
+// WithLogger specify the logger to write the events of handshakes and connections.
+func WithLogger(logger *slog.Logger) Option {
+	return func(options *options) {
+		options.logger = logger
+	}
+}
+
+// WithFrameTrace records every frame sent and received on the connections,
+// the payload passed to trace is truncated to maxPayload bytes.
+func WithFrameTrace(trace FrameTraceFunc, maxPayload int) Option {
+	return func(options *options) {
+		options.frameTrace, options.frameTracePayload = trace, maxPayload
+	}
+}
+
+// WithFrameTraceWriter writes every frame sent and received on the connections to w,
+// with the hex dump of the payload truncated to maxPayload bytes.
+func WithFrameTraceWriter(w io.Writer, maxPayload int) Option {
+	return WithFrameTrace(frameTraceWriter(w), maxPayload)
+}
+
+// WithPipeline adds the user handlers to the pipeline of every channel before the Conn handler,
+// the inbound messages are io.Reader of websocket messages and must be passed to the next handler.
+func WithPipeline(pipeline PipelineFunc) Option {
+	return func(options *options) {
+		options.pipeline = pipeline
+	}
+}
+
+// WithEngine runs the Websocket on the engine created by NewEngine, several Websockets can share one engine.
+// The engine is built by NewEngine instead of taking a netty.Bootstrap, because the transport and initializers
+// required by Websocket can not be checked on a built bootstrap.
+// The Websockets on the engine are canceled if the engine shuts down, closing a Websocket never shuts
+// down the engine.
+func WithEngine(engine *Engine) Option {
+	return func(options *options) {
+		if nil != engine {
+			options.engine = engine
+		}
+	}
+}
+
+// WithCodec sets the codec of WriteValue, ReadValue and OnMessage, the message type follows the codec.
+// A nil codec is returned as error by Listen, Open and UpgradeHTTP.
+func WithCodec(codec Codec) Option {
+	return func(options *options) {
+		if nil == codec {
+			options.fail(errors.New("nettyws: nil codec"))
+			return
+		}
+		options.codec = codec
+		options.messageType = codec.MessageType()
+	}
+}
+
+// WithUserKey resolves the user key of the server connections from the handshake request,
+// the presence of users is tracked by the user key, see Websocket.OnPresenceChange.
+func WithUserKey(userKey UserKeyFunc) Option {
+	return func(options *options) {
+		options.userKey = userKey
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// UserKeyFunc returns the user key of the handshake request, the handshake is rejected if err is not nil,
+// the HandshakeError is responded as is and the others are responded with 401.
+type UserKeyFunc func(request *http.Request) (user string, err error)
+
+// OnPresenceChangeFunc is called when the first connection of the user opens and the last one closes.
+type OnPresenceChangeFunc func(user string, online bool)
+
+type userKeyContext struct{}
+
+// presence is a presence change of the user.
+type presence struct {
+	user   string
+	online bool
+}
+
+// resolveUser returns the request carries the user key.
+func (ws *Websocket) resolveUser(request *http.Request) (*http.Request, error) {
+	if nil == ws.opts.userKey {
+		return request, nil
+	}
+
+	user, err := ws.opts.userKey(request)
+	if nil != err {
+		var handshakeErr HandshakeError
+		if !errors.As(err, &handshakeErr) {
+			err = HandshakeError{Status: http.StatusUnauthorized, Reason: err.Error()}
+		}
+		return request, err
+	}
+	return request.WithContext(context.WithValue(request.Context(), userKeyContext{}, user)), nil
+}
+
+// userOf returns the user key of the handshake request.
+func userOf(request *http.Request) string {
+	if nil == request {
+		return ""
+	}
+	user, _ := request.Context().Value(userKeyContext{}).(string)
+	return user
+}
+
+// joinUser adds the connection to the user, the user is online on the first connection.
+func (ws *Websocket) joinUser(c *wsConn) {
+	if "" == c.user {
+		return
+	}
+
+	ws.usersMutex.Lock()
+	conns, ok := ws.users[c.user]
+	if !ok {
+		conns = make(map[*wsConn]struct{})
+		ws.users[c.user] = conns
+		ws.presences = append(ws.presences, presence{user: c.user, online: true})
+	}
+	conns[c] = struct{}{}
+	ws.usersMutex.Unlock()
+
+	ws.notifyPresence(c)
+}
+
+// leaveUser removes the connection from the user, the user is offline on the last connection.
+func (ws *Websocket) leaveUser(c *wsConn) {
+	if "" == c.user {
+		return
+	}
+
+	ws.usersMutex.Lock()
+	conns := ws.users[c.user]
+	delete(conns, c)
+	if 0 == len(conns) {
+		delete(ws.users, c.user)
+		ws.presences = append(ws.presences, presence{user: c.user, online: false})
+	}
+	ws.usersMutex.Unlock()
+
+	ws.notifyPresence(c)
+}
+
+// notifyPresence calls OnPresenceChange with the queued presence changes outside the lock,
+// the changes are drained in order by one connection at a time.
+func (ws *Websocket) notifyPresence(c *wsConn) {
+	ws.usersMutex.Lock()
+	if ws.presenceDraining {
+		ws.usersMutex.Unlock()
+		return
+	}
+	ws.presenceDraining = true
+
+	for 0 != len(ws.presences) {
+		presences := ws.presences
+		ws.presences = nil
+		ws.usersMutex.Unlock()
+
+		if onPresenceChange := ws.OnPresenceChange; nil != onPresenceChange {
+			for _, p := range presences {
+				func() {
+					// the panic is logged, the remaining changes and the close of the connection go on
+					defer c.recoverCloseCallback("OnPresenceChange")
+					onPresenceChange(p.user, p.online)
+				}()
+			}
+		}
+
+		ws.usersMutex.Lock()
+	}
+
+	ws.presenceDraining = false
+	ws.usersMutex.Unlock()
+}
+
+// Online reports whether the user has connections.
+func (ws *Websocket) Online(user string) bool {
+	ws.usersMutex.RLock()
+	defer ws.usersMutex.RUnlock()
+	return len(ws.users[user]) > 0
+}
+
+// UserConns returns the connections of the user.
+func (ws *Websocket) UserConns(user string) []Conn {
+	ws.usersMutex.RLock()
+	defer ws.usersMutex.RUnlock()
+
+	conns := make([]Conn, 0, len(ws.users[user]))
+	for c := range ws.users[user] {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// SendToUser writes the message to all the connections of the user.
+func (ws *Websocket) SendToUser(user string, data []byte) error {
+	var errs []error
+	for _, conn := range ws.UserConns(user) {
+		if err := conn.Write(data); nil != err {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
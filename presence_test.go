@@ -0,0 +1,104 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPresence(t *testing.T) {
+	ws := NewWebsocket()
+	bob1, bob2 := &wsConn{ws: ws, user: "bob"}, &wsConn{ws: ws, user: "bob"}
+	alice := &wsConn{ws: ws, user: "alice"}
+
+	var changes []presence
+	ws.OnPresenceChange = func(user string, online bool) {
+		changes = append(changes, presence{user: user, online: online})
+		// the callback is called outside the lock
+		if "bob" == user && online {
+			_ = ws.Online("bob")
+			ws.joinUser(alice)
+		}
+	}
+
+	ws.joinUser(bob1)
+	ws.joinUser(bob2)
+	ws.leaveUser(bob1)
+	if !ws.Online("bob") || 1 != len(ws.UserConns("bob")) {
+		t.Fatal("bob offline with a connection")
+	}
+	ws.leaveUser(bob2)
+	ws.leaveUser(alice)
+
+	want := []presence{{"bob", true}, {"alice", true}, {"bob", false}, {"alice", false}}
+	if !reflect.DeepEqual(want, changes) {
+		t.Fatalf("changes: %v, want %v", changes, want)
+	}
+	if ws.Online("bob") || ws.Online("alice") {
+		t.Fatal("users online without connections")
+	}
+}
+
+func TestPresencePanic(t *testing.T) {
+	ws := NewWebsocket(WithBinary(), WithUserKey(func(request *http.Request) (string, error) {
+		return request.URL.Query().Get("user"), nil
+	}))
+
+	changes := make(chan presence, 4)
+	ws.OnPresenceChange = func(user string, online bool) {
+		changes <- presence{user: user, online: online}
+		panic("presence")
+	}
+	sinks := make(chan net.Conn, 1)
+	ws.OnOpen = func(conn Conn) {
+		nc, _ := NetConn(conn, MsgBinary)
+		sinks <- nc
+	}
+	closed := make(chan error, 1)
+	ws.UseClose(func(conn Conn, err error) {
+		closed <- err
+	})
+	url := serveTest(t, ws)
+
+	client := openTest(t, NewWebsocket(WithBinary()), url+"?user=bob")
+	sink := receiveTest(t, sinks)
+	read := make(chan error, 1)
+	go func() {
+		_, err := sink.Read(make([]byte, 16))
+		read <- err
+	}()
+	_ = client.Close()
+
+	// the panic of the presence change does not stop the close of the connection
+	receiveTest(t, closed)
+	if err := receiveTest(t, read); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("read after close: %v", err)
+	}
+	for _, want := range []presence{{"bob", true}, {"bob", false}} {
+		if p := receiveTest(t, changes); want != p {
+			t.Fatalf("change %v, want %v", p, want)
+		}
+	}
+	if ws.Online("bob") {
+		t.Fatal("bob online without connections")
+	}
+}
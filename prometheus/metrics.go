@@ -0,0 +1,212 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package prometheus implements nettyws.Metrics exposed in the Prometheus text format,
+// without depending on the Prometheus client library.
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// Metrics collects the metrics of the Websocket and serves them in the Prometheus text format.
+type Metrics struct {
+	namespace          string
+	handshakesAccepted atomic.Int64
+	connsActive        [2]atomic.Int64 // server, client
+	messagesIn         atomic.Int64
+	bytesIn            atomic.Int64
+	messagesOut        atomic.Int64
+	bytesOut           atomic.Int64
+	compressionSaved   atomic.Int64
+	queueDepth         atomic.Int64
+	errors             atomic.Int64
+	mutex              sync.Mutex
+	handshakesRejected map[int]int64
+	connsClosed        map[int]int64
+}
+
+var _ nettyws.Metrics = (*Metrics)(nil)
+
+// NewMetrics create a Metrics, the names of the metrics are prefixed with the namespace.
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		namespace:          namespace,
+		handshakesRejected: make(map[int]int64),
+		connsClosed:        make(map[int]int64),
+	}
+}
+
+func side(client bool) int {
+	if client {
+		return 1
+	}
+	return 0
+}
+
+// HandshakeAccepted implements nettyws.Metrics.
+func (m *Metrics) HandshakeAccepted() {
+	m.handshakesAccepted.Add(1)
+}
+
+// HandshakeRejected implements nettyws.Metrics.
+func (m *Metrics) HandshakeRejected(status int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.handshakesRejected[status]++
+}
+
+// ConnOpened implements nettyws.Metrics.
+func (m *Metrics) ConnOpened(client bool) {
+	m.connsActive[side(client)].Add(1)
+}
+
+// ConnClosed implements nettyws.Metrics.
+func (m *Metrics) ConnClosed(client bool, code int) {
+	m.connsActive[side(client)].Add(-1)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.connsClosed[code]++
+}
+
+// MessageIn implements nettyws.Metrics.
+func (m *Metrics) MessageIn(size int) {
+	m.messagesIn.Add(1)
+	m.bytesIn.Add(int64(size))
+}
+
+// MessageOut implements nettyws.Metrics.
+func (m *Metrics) MessageOut(size int) {
+	m.messagesOut.Add(1)
+	m.bytesOut.Add(int64(size))
+}
+
+// CompressionSaved implements nettyws.Metrics.
+func (m *Metrics) CompressionSaved(bytes int64) {
+	m.compressionSaved.Add(bytes)
+}
+
+// WriteQueueDepth implements nettyws.Metrics.
+func (m *Metrics) WriteQueueDepth(messages int) {
+	m.queueDepth.Store(int64(messages))
+}
+
+// Error implements nettyws.Metrics.
+func (m *Metrics) Error(err error) {
+	m.errors.Add(1)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(writer)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	p := &printer{w: w, namespace: m.namespace}
+
+	p.header("handshakes_accepted_total", "counter", "Number of accepted handshakes.")
+	p.sample("handshakes_accepted_total", "", m.handshakesAccepted.Load())
+
+	m.mutex.Lock()
+	handshakesRejected := sortedCopy(m.handshakesRejected)
+	connsClosed := sortedCopy(m.connsClosed)
+	m.mutex.Unlock()
+
+	p.header("handshakes_rejected_total", "counter", "Number of rejected handshakes by http status.")
+	for _, kv := range handshakesRejected {
+		p.sample("handshakes_rejected_total", fmt.Sprintf(`{status="%d"}`, kv[0]), kv[1])
+	}
+
+	p.header("connections", "gauge", "Number of active connections.")
+	p.sample("connections", `{side="server"}`, m.connsActive[0].Load())
+	p.sample("connections", `{side="client"}`, m.connsActive[1].Load())
+
+	p.header("connections_closed_total", "counter", "Number of closed connections by close code.")
+	for _, kv := range connsClosed {
+		p.sample("connections_closed_total", fmt.Sprintf(`{code="%d"}`, kv[0]), kv[1])
+	}
+
+	p.header("messages_total", "counter", "Number of messages.")
+	p.sample("messages_total", `{direction="in"}`, m.messagesIn.Load())
+	p.sample("messages_total", `{direction="out"}`, m.messagesOut.Load())
+
+	p.header("message_bytes_total", "counter", "Payload bytes of messages.")
+	p.sample("message_bytes_total", `{direction="in"}`, m.bytesIn.Load())
+	p.sample("message_bytes_total", `{direction="out"}`, m.bytesOut.Load())
+
+	p.header("compression_saved_bytes_total", "counter", "Bytes saved by compression.")
+	p.sample("compression_saved_bytes_total", "", m.compressionSaved.Load())
+
+	p.header("write_queue_depth", "gauge", "Number of messages queued by async write of all connections.")
+	p.sample("write_queue_depth", "", m.queueDepth.Load())
+
+	p.header("errors_total", "counter", "Number of connection errors.")
+	p.sample("errors_total", "", m.errors.Load())
+
+	return p.n, p.err
+}
+
+// sortedCopy returns the key-value pairs of the map sorted by key.
+func sortedCopy(m map[int]int64) [][2]int64 {
+	kvs := make([][2]int64, 0, len(m))
+	for k, v := range m {
+		kvs = append(kvs, [2]int64{int64(k), v})
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i][0] < kvs[j][0] })
+	return kvs
+}
+
+// printer writes the text format and keeps the first error.
+type printer struct {
+	w         io.Writer
+	namespace string
+	n         int64
+	err       error
+}
+
+func (p *printer) name(name string) string {
+	if "" == p.namespace {
+		return name
+	}
+	return p.namespace + "_" + name
+}
+
+func (p *printer) header(name, typ, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", p.name(name), help, p.name(name), typ)
+}
+
+func (p *printer) sample(name, labels string, value int64) {
+	p.printf("%s%s %d\n", p.name(name), labels, value)
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if nil != p.err {
+		return
+	}
+	n, err := fmt.Fprintf(p.w, format, args...)
+	p.n += int64(n)
+	p.err = err
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsWriteTo(t *testing.T) {
+	m := NewMetrics("ws")
+	m.HandshakeAccepted()
+	m.HandshakeRejected(http.StatusTooManyRequests)
+	m.HandshakeRejected(http.StatusServiceUnavailable)
+	m.HandshakeRejected(http.StatusTooManyRequests)
+	m.ConnOpened(false)
+	m.ConnOpened(false)
+	m.ConnOpened(true)
+	m.ConnClosed(false, 1000)
+	m.MessageIn(10)
+	m.MessageIn(5)
+	m.MessageOut(7)
+	m.CompressionSaved(100)
+	m.WriteQueueDepth(3)
+	m.WriteQueueDepth(2)
+	m.Error(errors.New("reset"))
+
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	if nil != err || int(n) != b.Len() {
+		t.Fatalf("WriteTo returns %d, %v, written %d", n, err, b.Len())
+	}
+
+	want := `# HELP ws_handshakes_accepted_total Number of accepted handshakes.
+# TYPE ws_handshakes_accepted_total counter
+ws_handshakes_accepted_total 1
+# HELP ws_handshakes_rejected_total Number of rejected handshakes by http status.
+# TYPE ws_handshakes_rejected_total counter
+ws_handshakes_rejected_total{status="429"} 2
+ws_handshakes_rejected_total{status="503"} 1
+# HELP ws_connections Number of active connections.
+# TYPE ws_connections gauge
+ws_connections{side="server"} 1
+ws_connections{side="client"} 1
+# HELP ws_connections_closed_total Number of closed connections by close code.
+# TYPE ws_connections_closed_total counter
+ws_connections_closed_total{code="1000"} 1
+# HELP ws_messages_total Number of messages.
+# TYPE ws_messages_total counter
+ws_messages_total{direction="in"} 2
+ws_messages_total{direction="out"} 1
+# HELP ws_message_bytes_total Payload bytes of messages.
+# TYPE ws_message_bytes_total counter
+ws_message_bytes_total{direction="in"} 15
+ws_message_bytes_total{direction="out"} 7
+# HELP ws_compression_saved_bytes_total Bytes saved by compression.
+# TYPE ws_compression_saved_bytes_total counter
+ws_compression_saved_bytes_total 100
+# HELP ws_write_queue_depth Number of messages queued by async write of all connections.
+# TYPE ws_write_queue_depth gauge
+ws_write_queue_depth 2
+# HELP ws_errors_total Number of connection errors.
+# TYPE ws_errors_total counter
+ws_errors_total 1
+`
+	if got := b.String(); got != want {
+		t.Fatalf("WriteTo:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricsServeHTTP(t *testing.T) {
+	m := NewMetrics("")
+	m.HandshakeAccepted()
+
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("content type %q", contentType)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "\nhandshakes_accepted_total 1\n") {
+		t.Fatalf("body without namespace:\n%s", body)
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package pubsub implements the topic based publish and subscribe of nettyws connections.
+//
+// The topics are "/" separated levels, the filters support the MQTT wildcards "+" and "#".
+// The messages are encoded with the codec of the connection, see nettyws.WithCodec:
+//
+//	{"op": "subscribe", "topic": "chat/+/message"}      client subscribes the filter
+//	{"op": "unsubscribe", "topic": "chat/+/message"}    client unsubscribes the filter
+//	{"op": "publish", "topic": "chat/1/message", ...}   server publishes the data
+//	{"op": "error", "topic": "chat/#/x", ...}           server rejects the filter
+package pubsub
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// operations of the wire protocol
+const (
+	OpSubscribe   = "subscribe"
+	OpUnsubscribe = "unsubscribe"
+	OpPublish     = "publish"
+	OpError       = "error"
+)
+
+// Message is the message of the wire protocol.
+type Message struct {
+	Op    string      `json:"op" msgpack:"op"`
+	Topic string      `json:"topic" msgpack:"topic"`
+	Data  interface{} `json:"data,omitempty" msgpack:"data,omitempty"`
+	Error string      `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// ErrInvalidTopic is returned by Publish if the topic is empty or has wildcards.
+var ErrInvalidTopic = errors.New("pubsub: invalid topic")
+
+// Broker fans out the published messages to the subscribers of a Websocket.
+type Broker struct {
+	mutex sync.RWMutex
+	root  *node
+	// the filters of the connections unwrapped from the middlewares
+	subs map[nettyws.Conn]map[string]struct{}
+}
+
+// New create a broker bound to the Websocket, the subscribe and unsubscribe messages
+// are consumed by the middleware, the others are passed to OnData. The subscriptions
+// are removed by a close callback of Websocket.UseClose, New must be called before
+// Listen, Open or UpgradeHTTP.
+func New(ws *nettyws.Websocket) *Broker {
+	b := &Broker{root: newNode(), subs: make(map[nettyws.Conn]map[string]struct{})}
+	ws.Use(b.middleware)
+	ws.UseClose(func(conn nettyws.Conn, _ error) {
+		b.UnsubscribeAll(conn)
+	})
+	return b
+}
+
+// middleware consumes the messages of the wire protocol.
+func (b *Broker) middleware(next nettyws.Handler) nettyws.Handler {
+	return func(conn nettyws.Conn, data []byte) {
+		var message Message
+		if err := conn.Codec().Unmarshal(data, &message); nil != err {
+			next(conn, data)
+			return
+		}
+
+		switch message.Op {
+		case OpSubscribe:
+			if err := b.Subscribe(conn, message.Topic); nil != err {
+				_ = nettyws.WriteValue(conn, &Message{Op: OpError, Topic: message.Topic, Error: err.Error()})
+			}
+		case OpUnsubscribe:
+			b.Unsubscribe(conn, message.Topic)
+		default:
+			next(conn, data)
+		}
+	}
+}
+
+// Subscribe subscribes the connection to the topic filter, the subscriber is the connection
+// unwrapped from the middlewares, see nettyws.Unwrap.
+func (b *Broker) Subscribe(conn nettyws.Conn, filter string) error {
+	if !validFilter(filter) {
+		return errors.New("pubsub: invalid topic filter")
+	}
+
+	conn = nettyws.Unwrap(conn)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	filters, ok := b.subs[conn]
+	if !ok {
+		filters = make(map[string]struct{})
+		b.subs[conn] = filters
+	}
+	filters[filter] = struct{}{}
+	b.root.add(strings.Split(filter, "/"), conn)
+	return nil
+}
+
+// Unsubscribe unsubscribes the connection from the topic filter.
+func (b *Broker) Unsubscribe(conn nettyws.Conn, filter string) {
+	conn = nettyws.Unwrap(conn)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if filters, ok := b.subs[conn]; ok {
+		if _, ok = filters[filter]; ok {
+			delete(filters, filter)
+			b.root.remove(strings.Split(filter, "/"), conn)
+		}
+		if 0 == len(filters) {
+			delete(b.subs, conn)
+		}
+	}
+}
+
+// UnsubscribeAll removes all the subscriptions of the connection.
+func (b *Broker) UnsubscribeAll(conn nettyws.Conn) {
+	conn = nettyws.Unwrap(conn)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for filter := range b.subs[conn] {
+		b.root.remove(strings.Split(filter, "/"), conn)
+	}
+	delete(b.subs, conn)
+}
+
+// Subscribers returns the connections subscribed the topic.
+func (b *Broker) Subscribers(topic string) []nettyws.Conn {
+	matched := make(map[nettyws.Conn]struct{})
+	b.mutex.RLock()
+	b.root.match(strings.Split(topic, "/"), true, matched)
+	b.mutex.RUnlock()
+
+	conns := make([]nettyws.Conn, 0, len(matched))
+	for conn := range matched {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Publish sends the data to the subscribers of the topic, the message is encoded once and
+// written to every subscriber. The number of subscribers written is returned.
+//
+// The subscribers are written synchronously by the publisher, a slow subscriber stalls the
+// publisher unless the Websocket uses WithAsyncWrite with a non-blocking WithWriteQueuePolicy.
+func (b *Broker) Publish(topic string, data interface{}) (int, error) {
+	if !validTopic(topic) {
+		return 0, ErrInvalidTopic
+	}
+
+	conns := b.Subscribers(topic)
+	if 0 == len(conns) {
+		return 0, nil
+	}
+
+	// the connections of a Websocket share the codec
+	prepared, err := conns[0].Codec().Marshal(&Message{Op: OpPublish, Topic: topic, Data: data})
+	if nil != err {
+		return 0, err
+	}
+
+	written := 0
+	for _, conn := range conns {
+		if nil == conn.Write(prepared) {
+			written++
+		}
+	}
+	return written, nil
+}
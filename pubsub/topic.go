@@ -0,0 +1,120 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"strings"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// validFilter reports whether the MQTT topic filter is valid, the "+" matches a single level
+// and the "#" matches the remaining levels, both must occupy an entire level.
+func validFilter(filter string) bool {
+	if "" == filter {
+		return false
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case "#" == level && i != len(levels)-1:
+			return false
+		case "#" != level && "+" != level && strings.ContainsAny(level, "+#"):
+			return false
+		}
+	}
+	return true
+}
+
+// validTopic reports whether the topic name has no wildcards.
+func validTopic(topic string) bool {
+	return "" != topic && !strings.ContainsAny(topic, "+#")
+}
+
+// node is a level of the topic filters.
+type node struct {
+	children map[string]*node
+	subs     map[nettyws.Conn]struct{}
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node), subs: make(map[nettyws.Conn]struct{})}
+}
+
+// add subscribes the filter.
+func (n *node) add(levels []string, conn nettyws.Conn) {
+	for _, level := range levels {
+		child, ok := n.children[level]
+		if !ok {
+			child = newNode()
+			n.children[level] = child
+		}
+		n = child
+	}
+	n.subs[conn] = struct{}{}
+}
+
+// remove unsubscribes the filter and prunes the empty nodes.
+func (n *node) remove(levels []string, conn nettyws.Conn) {
+	if 0 == len(levels) {
+		delete(n.subs, conn)
+		return
+	}
+
+	child, ok := n.children[levels[0]]
+	if !ok {
+		return
+	}
+	child.remove(levels[1:], conn)
+	if 0 == len(child.subs) && 0 == len(child.children) {
+		delete(n.children, levels[0])
+	}
+}
+
+// match collects the subscribers of the topic, the wildcards at the first level
+// do not match the topics beginning with "$".
+func (n *node) match(levels []string, first bool, matched map[nettyws.Conn]struct{}) {
+	wildcard := !first || !strings.HasPrefix(levels[0], "$")
+
+	// "a/#" matches "a" and all the sub levels
+	if child, ok := n.children["#"]; ok && wildcard {
+		for conn := range child.subs {
+			matched[conn] = struct{}{}
+		}
+	}
+
+	for _, level := range []string{levels[0], "+"} {
+		child, ok := n.children[level]
+		if !ok || ("+" == level && !wildcard) {
+			continue
+		}
+
+		if 1 == len(levels) {
+			for conn := range child.subs {
+				matched[conn] = struct{}{}
+			}
+			if grandchild, ok := child.children["#"]; ok {
+				for conn := range grandchild.subs {
+					matched[conn] = struct{}{}
+				}
+			}
+			continue
+		}
+		child.match(levels[1:], false, matched)
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pubsub
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+// wrapConn is the conn passed by a middleware.
+type wrapConn struct {
+	nettyws.Conn
+}
+
+func (c *wrapConn) Unwrap() nettyws.Conn {
+	return c.Conn
+}
+
+func TestValidFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{filter: "a/b/c", want: true},
+		{filter: "#", want: true},
+		{filter: "+", want: true},
+		{filter: "a/+/c", want: true},
+		{filter: "a/#", want: true},
+		{filter: "+/+/#", want: true},
+		{filter: "$SYS/#", want: true},
+		{filter: "a//b", want: true},
+		{filter: "", want: false},
+		{filter: "a/#/c", want: false},
+		{filter: "a/b#", want: false},
+		{filter: "a/+b", want: false},
+		{filter: "#/a", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := validFilter(tt.filter); got != tt.want {
+			t.Errorf("validFilter(%q) = %t, want %t", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestValidTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{topic: "a/b", want: true},
+		{topic: "$SYS/broker", want: true},
+		{topic: "", want: false},
+		{topic: "a/+", want: false},
+		{topic: "a/#", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := validTopic(tt.topic); got != tt.want {
+			t.Errorf("validTopic(%q) = %t, want %t", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	filters := []string{"#", "+", "a", "a/#", "a/+", "a/+/c", "+/b/#", "$SYS/#", "$SYS/+", "a//c"}
+
+	tests := []struct {
+		topic string
+		want  []string
+	}{
+		{topic: "a", want: []string{"#", "+", "a", "a/#"}},
+		{topic: "a/b", want: []string{"#", "a/#", "a/+", "+/b/#"}},
+		{topic: "a/b/c", want: []string{"#", "a/#", "a/+/c", "+/b/#"}},
+		{topic: "x/b", want: []string{"#", "+/b/#"}},
+		{topic: "a//c", want: []string{"#", "a/#", "a/+/c", "a//c"}},
+		{topic: "$SYS", want: []string{"$SYS/#"}},
+		{topic: "$SYS/broker", want: []string{"$SYS/#", "$SYS/+"}},
+		{topic: "$SYS/b/x", want: []string{"$SYS/#"}},
+		{topic: "z/$SYS", want: []string{"#"}},
+	}
+
+	b := &Broker{root: newNode(), subs: make(map[nettyws.Conn]map[string]struct{})}
+	for _, filter := range filters {
+		if err := b.Subscribe(wstest.NewConn(filter), filter); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, conn := range b.Subscribers(tt.topic) {
+			got = append(got, conn.(*wstest.Conn).Name)
+		}
+		sort.Strings(got)
+		sort.Strings(tt.want)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("Subscribers(%q) = %q, want %q", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := &Broker{root: newNode(), subs: make(map[nettyws.Conn]map[string]struct{})}
+	conn := wstest.NewConn("a")
+	for _, filter := range []string{"a/+", "a/#"} {
+		// the middleware passes the wrapped conn, the close callback passes the conn
+		if err := b.Subscribe(&wrapConn{Conn: conn}, filter); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	b.Unsubscribe(&wrapConn{Conn: conn}, "a/+")
+	if subscribers := b.Subscribers("a/b"); 1 != len(subscribers) || conn != subscribers[0] {
+		t.Fatal("the remaining filter does not match")
+	}
+
+	b.UnsubscribeAll(conn)
+	if 0 != len(b.Subscribers("a/b")) || 0 != len(b.subs) || 0 != len(b.root.children) {
+		t.Fatal("the subscriptions are not pruned")
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	ws := nettyws.NewWebsocket()
+	b := New(ws)
+	subscribed := make(chan struct{}, 1)
+	ws.Use(func(next nettyws.Handler) nettyws.Handler {
+		return func(conn nettyws.Conn, data []byte) {
+			next(&wrapConn{Conn: conn}, data)
+		}
+	})
+	ws.OnData = func(conn nettyws.Conn, data []byte) {
+		subscribed <- struct{}{}
+	}
+	closed := make(chan struct{}, 1)
+	ws.UseClose(func(conn nettyws.Conn, err error) {
+		closed <- struct{}{}
+	})
+
+	received := make(chan Message, 1)
+	client := nettyws.NewWebsocket()
+	client.OnData = func(conn nettyws.Conn, data []byte) {
+		var message Message
+		if err := nettyws.ReadValue(conn, data, &message); nil != err {
+			t.Error(err)
+		}
+		received <- message
+	}
+	conn := wstest.Open(t, client, wstest.Serve(t, ws))
+
+	// the ping after the subscribe is passed to OnData
+	for _, message := range []interface{}{&Message{Op: OpSubscribe, Topic: "chat/+"}, &Message{Op: "ping"}} {
+		if err := nettyws.WriteValue(conn, message); nil != err {
+			t.Fatal(err)
+		}
+	}
+	wstest.Receive(t, subscribed)
+
+	if n, err := b.Publish("chat/1", "hello"); nil != err || 1 != n {
+		t.Fatalf("published to %d subscribers, %v", n, err)
+	}
+	if message := wstest.Receive(t, received); OpPublish != message.Op || "chat/1" != message.Topic || "hello" != message.Data {
+		t.Fatalf("received %+v", message)
+	}
+
+	// the subscriptions are removed when the connection is closed
+	_ = conn.Close()
+	wstest.Receive(t, closed)
+	if 0 != len(b.Subscribers("chat/1")) {
+		t.Fatal("the subscriptions of the closed connection are not removed")
+	}
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-netty/go-netty"
+)
+
+// QueuePolicy defines the behavior of an async write when the write queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock blocks the writer until the queue has free space.
+	QueueBlock QueuePolicy = iota
+	// QueueDropOldest discards the oldest queued message to make room for the new one.
+	QueueDropOldest
+	// QueueDropNewest discards the new message and returns ErrWriteQueueFull.
+	QueueDropNewest
+	// QueueDisconnect closes the connection with 1008 (policy violation).
+	QueueDisconnect
+)
+
+const (
+	writeQueueIdle    = 0
+	writeQueueRunning = 1
+)
+
+// writeQueueDrainTimeout is the max duration of Close waits the blocking queue to be sent.
+const writeQueueDrainTimeout = 10 * time.Second
+
+// writeQueue is the bounded outbound message queue of an async write connection.
+type writeQueue struct {
+	channel netty.Channel
+	policy  QueuePolicy
+	queue   chan []byte
+	buffers [][]byte
+	bytes   int64
+	running int32
+	closing atomic.Pointer[ClosedError]
+	depth   func(delta int)
+	// the write deadline of push, the changed channel is closed when the deadline changes
+	deadlineMutex sync.Mutex
+	deadline      time.Time
+	changed       chan struct{}
+}
+
+// newWriteQueue create a write queue with the queue size and the full queue policy.
+func newWriteQueue(channel netty.Channel, size int, policy QueuePolicy) *writeQueue {
+	return &writeQueue{
+		channel: channel,
+		policy:  policy,
+		queue:   make(chan []byte, size),
+		buffers: make([][]byte, 0, size/2+1),
+		changed: make(chan struct{}),
+	}
+}
+
+// setDeadline sets the deadline of push, the blocked pushes apply the new deadline.
+func (q *writeQueue) setDeadline(t time.Time) {
+	q.deadlineMutex.Lock()
+	defer q.deadlineMutex.Unlock()
+	q.deadline = t
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// writeDeadline returns the deadline of push and the channel closed when it changes.
+func (q *writeQueue) writeDeadline() (time.Time, <-chan struct{}) {
+	q.deadlineMutex.Lock()
+	defer q.deadlineMutex.Unlock()
+	return q.deadline, q.changed
+}
+
+// Buffered returns the number of queued messages and bytes.
+func (q *writeQueue) Buffered() (messages int, bytes int) {
+	return len(q.queue), int(atomic.LoadInt64(&q.bytes))
+}
+
+// account the queued (sign 1) or dequeued (sign -1) packet.
+func (q *writeQueue) account(packet []byte, sign int) {
+	atomic.AddInt64(&q.bytes, int64(sign*len(packet)))
+	if nil != q.depth {
+		q.depth(sign)
+	}
+}
+
+// push the message into the queue, onFull will be invoked when the queue is full.
+func (q *writeQueue) push(message []byte, onFull func()) error {
+	if nil != q.closing.Load() {
+		return ErrWriteQueueFull
+	}
+	if deadline, _ := q.writeDeadline(); !deadline.IsZero() && !time.Now().Before(deadline) {
+		return os.ErrDeadlineExceeded
+	}
+
+	// copy message, the caller may reuse the buffer.
+	packet := make([]byte, len(message))
+	copy(packet, message)
+
+	q.account(packet, 1)
+
+	select {
+	case q.queue <- packet:
+	default:
+		if nil != onFull {
+			onFull()
+		}
+
+		if err := q.pushFull(packet); nil != err {
+			q.account(packet, -1)
+			return err
+		}
+	}
+
+	q.schedule()
+	return nil
+}
+
+// schedule starts the write loop if it is not running.
+func (q *writeQueue) schedule() {
+	if atomic.CompareAndSwapInt32(&q.running, writeQueueIdle, writeQueueRunning) {
+		go q.writeLoop()
+	}
+}
+
+func (q *writeQueue) pushFull(packet []byte) error {
+	ctx := q.channel.Context()
+
+	switch q.policy {
+	case QueueBlock:
+		for {
+			deadline, changed := q.writeDeadline()
+			var timer *time.Timer
+			var timeout <-chan time.Time
+			if !deadline.IsZero() {
+				timer = time.NewTimer(time.Until(deadline))
+				timeout = timer.C
+			}
+
+			select {
+			case <-ctx.Done():
+				return ErrServerClosed
+			case q.queue <- packet:
+				return nil
+			case <-timeout:
+				return os.ErrDeadlineExceeded
+			case <-changed:
+				// wait again with the new deadline
+				if nil != timer {
+					timer.Stop()
+				}
+			}
+		}
+	case QueueDropOldest:
+		// prefer queueing over dropping, a select with both cases ready picks randomly
+		for {
+			select {
+			case q.queue <- packet:
+				return nil
+			default:
+			}
+
+			select {
+			case <-ctx.Done():
+				return ErrServerClosed
+			case oldest := <-q.queue:
+				q.account(oldest, -1)
+			default:
+			}
+		}
+	case QueueDisconnect:
+		// the close frame is written by the write loop, never concurrently with the queued messages.
+		q.closing.CompareAndSwap(nil, &ClosedError{Code: 1008, Reason: "write queue full"})
+		q.schedule()
+		return ErrWriteQueueFull
+	default:
+		return ErrWriteQueueFull
+	}
+}
+
+// writeLoop sending queued messages of channel
+func (q *writeQueue) writeLoop() {
+	for {
+		if closeErr := q.closing.Load(); nil != closeErr {
+			_ = q.channel.Transport().(wsc).WriteClose(closeErr.Code, closeErr.Reason)
+			q.channel.Close(*closeErr)
+			q.discard()
+			atomic.StoreInt32(&q.running, writeQueueIdle)
+			return
+		}
+
+		// more packet will be merged
+		buffers := q.buffers[:0]
+		for len(buffers) < cap(buffers) {
+			select {
+			case pkt := <-q.queue:
+				buffers = append(buffers, pkt)
+				continue
+			default:
+			}
+			break
+		}
+
+		if len(buffers) > 0 {
+			_, err := q.channel.Writev(buffers)
+
+			// avoid memory leak
+			for index, buf := range buffers {
+				q.account(buf, -1)
+				buffers[index] = nil
+			}
+
+			if nil != err {
+				q.channel.Close(err)
+				q.discard()
+				atomic.StoreInt32(&q.running, writeQueueIdle)
+				return
+			}
+		}
+
+		// double check
+		atomic.StoreInt32(&q.running, writeQueueIdle)
+		if (len(q.queue) > 0 || nil != q.closing.Load()) && atomic.CompareAndSwapInt32(&q.running, writeQueueIdle, writeQueueRunning) {
+			continue
+		}
+		break
+	}
+}
+
+// discard the unsent messages after the channel is closed.
+func (q *writeQueue) discard() {
+	for {
+		select {
+		case pkt := <-q.queue:
+			q.account(pkt, -1)
+		default:
+			return
+		}
+	}
+}
+
+// wait for the queued messages to be sent, blocking policy waits up to writeQueueDrainTimeout
+// for a peer that stops reading.
+func (q *writeQueue) wait() {
+	timeout := time.Second
+	if QueueBlock == q.policy {
+		timeout = writeQueueDrainTimeout
+	}
+
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline) && q.channel.IsActive(); {
+		if 0 == len(q.queue) && writeQueueIdle == atomic.LoadInt32(&q.running) {
+			return
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
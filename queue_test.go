@@ -0,0 +1,253 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-netty/go-netty"
+	"github.com/go-netty/go-netty/transport"
+)
+
+// fakeTransport records the close frame and whether it overlapped with a write.
+type fakeTransport struct {
+	transport.Transport
+	channel   *fakeChannel
+	closeCode int
+	overlap   bool
+}
+
+func (t *fakeTransport) WriteClose(code int, reason string) error {
+	t.channel.mutex.Lock()
+	defer t.channel.mutex.Unlock()
+	t.closeCode = code
+	t.overlap = t.overlap || t.channel.writing
+	return nil
+}
+
+// fakeChannel is a channel writes into memory, the write is blocked until release is closed.
+type fakeChannel struct {
+	netty.Channel
+	ctx       context.Context
+	cancel    context.CancelFunc
+	transport *fakeTransport
+	release   chan struct{}
+	mutex     sync.Mutex
+	writing   bool
+	written   [][]byte
+	closeErr  error
+}
+
+func newFakeChannel() *fakeChannel {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	close(release)
+	channel := &fakeChannel{ctx: ctx, cancel: cancel, release: release}
+	channel.transport = &fakeTransport{channel: channel}
+	return channel
+}
+
+func (c *fakeChannel) Context() context.Context       { return c.ctx }
+func (c *fakeChannel) Transport() transport.Transport { return c.transport }
+func (c *fakeChannel) IsActive() bool                 { return nil == c.ctx.Err() }
+
+func (c *fakeChannel) Writev(buffers [][]byte) (int64, error) {
+	c.mutex.Lock()
+	c.writing = true
+	c.mutex.Unlock()
+
+	<-c.release
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.writing = false
+	var n int64
+	for _, buf := range buffers {
+		c.written = append(c.written, buf)
+		n += int64(len(buf))
+	}
+	return n, nil
+}
+
+func (c *fakeChannel) Close(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if nil == c.closeErr {
+		c.closeErr = err
+	}
+	c.cancel()
+}
+
+func (c *fakeChannel) messages() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.written)
+}
+
+func TestWriteQueuePush(t *testing.T) {
+	channel := newFakeChannel()
+	queue := newWriteQueue(channel, 4, QueueBlock)
+
+	message := []byte("hello")
+	if err := queue.push(message, nil); nil != err {
+		t.Fatal(err)
+	}
+	message[0] = 'j'
+
+	queue.wait()
+	if 1 != channel.messages() || "hello" != string(channel.written[0]) {
+		t.Fatalf("written %q, want the copy of hello", channel.written)
+	}
+	if messages, bytes := queue.Buffered(); 0 != messages || 0 != bytes {
+		t.Fatalf("buffered %d messages %d bytes after sent", messages, bytes)
+	}
+}
+
+func TestWriteQueueFull(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  QueuePolicy
+		wantErr error
+		onFull  bool
+	}{
+		{name: "drop newest", policy: QueueDropNewest, wantErr: ErrWriteQueueFull, onFull: true},
+		{name: "drop oldest", policy: QueueDropOldest, onFull: true},
+		{name: "disconnect", policy: QueueDisconnect, wantErr: ErrWriteQueueFull, onFull: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := newFakeChannel()
+			channel.release = make(chan struct{})
+			queue := newWriteQueue(channel, 2, tt.policy)
+
+			// the first message is taken by the blocked write loop
+			if err := queue.push([]byte("0"), nil); nil != err {
+				t.Fatal(err)
+			}
+			for !func() bool { channel.mutex.Lock(); defer channel.mutex.Unlock(); return channel.writing }() {
+				time.Sleep(time.Millisecond)
+			}
+
+			for _, message := range []string{"1", "2"} {
+				if err := queue.push([]byte(message), nil); nil != err {
+					t.Fatal(err)
+				}
+			}
+
+			onFull := false
+			err := queue.push([]byte("3"), func() { onFull = true })
+			if !errors.Is(err, tt.wantErr) || onFull != tt.onFull {
+				t.Fatalf("push = %v, onFull %t, want %v, %t", err, onFull, tt.wantErr, tt.onFull)
+			}
+
+			if QueueDropOldest == tt.policy {
+				if pkt := <-queue.queue; "2" != string(pkt) {
+					t.Fatalf("oldest message %q not dropped", pkt)
+				}
+			}
+
+			close(channel.release)
+			queue.wait()
+
+			if QueueDisconnect == tt.policy {
+				channel.mutex.Lock()
+				defer channel.mutex.Unlock()
+				if 1008 != channel.transport.closeCode || channel.transport.overlap {
+					t.Fatalf("close code %d, overlapped with write %t", channel.transport.closeCode, channel.transport.overlap)
+				}
+				if !errors.Is(queue.push([]byte("4"), nil), ErrWriteQueueFull) {
+					t.Fatal("push succeeded after disconnect")
+				}
+			}
+		})
+	}
+}
+
+func TestWriteQueueWaitBounded(t *testing.T) {
+	channel := newFakeChannel()
+	channel.release = make(chan struct{})
+	defer close(channel.release)
+
+	queue := newWriteQueue(channel, 1, QueueDropNewest)
+	if err := queue.push([]byte("stuck"), nil); nil != err {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	queue.wait()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("wait took %s with a stuck peer", elapsed)
+	}
+}
+
+func TestWriteQueueDeadline(t *testing.T) {
+	channel := newFakeChannel()
+	channel.release = make(chan struct{})
+	queue := newWriteQueue(channel, 1, QueueBlock)
+
+	// the first message is taken by the blocked write loop, the second fills the queue
+	if err := queue.push([]byte("0"), nil); nil != err {
+		t.Fatal(err)
+	}
+	for !func() bool { channel.mutex.Lock(); defer channel.mutex.Unlock(); return channel.writing }() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := queue.push([]byte("1"), nil); nil != err {
+		t.Fatal(err)
+	}
+
+	// the blocked push times out
+	queue.setDeadline(time.Now().Add(20 * time.Millisecond))
+	if err := queue.push([]byte("2"), nil); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("blocked push = %v, want deadline exceeded", err)
+	}
+	// the push after the deadline fails immediately
+	if err := queue.push([]byte("2"), nil); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("push = %v, want deadline exceeded", err)
+	}
+
+	// the blocked push applies the changed deadline
+	queue.setDeadline(time.Time{})
+	pushed := make(chan error, 1)
+	go func() { pushed <- queue.push([]byte("3"), nil) }()
+	select {
+	case err := <-pushed:
+		t.Fatalf("push to the full queue returns %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	queue.setDeadline(time.Now())
+	if err := receiveTest(t, pushed); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("blocked push = %v, want deadline exceeded", err)
+	}
+
+	// the queue accepts the messages after the deadline is cleared
+	queue.setDeadline(time.Time{})
+	close(channel.release)
+	if err := queue.push([]byte("4"), nil); nil != err {
+		t.Fatal(err)
+	}
+	queue.wait()
+	if messages, bytes := queue.Buffered(); 0 != messages || 0 != bytes || 3 != channel.messages() {
+		t.Fatalf("buffered %d messages %d bytes, written %q", messages, bytes, channel.written)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitAction defines the action when a connection exceeds the inbound rate limit.
+type RateLimitAction int
+
+const (
+	// RateLimitDrop drops the messages exceeding the limit.
+	RateLimitDrop RateLimitAction = iota
+	// RateLimitDelay delays reading until the limit allows.
+	RateLimitDelay
+	// RateLimitClose closes the connection with 1008 (policy violation).
+	RateLimitClose
+)
+
+// tokenBucket is a token bucket refilled with rate tokens per second, the burst is one second of tokens.
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket create a full token bucket, nil returned if rate is not positive.
+func newTokenBucket(rate int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// allow takes n tokens if available, n larger than the burst is allowed when the bucket is full.
+func (b *tokenBucket) allow(n int) bool {
+	return allowBoth(b, n, nil, 0)
+}
+
+// available reports whether n tokens can be taken, the mutex must be held.
+func (b *tokenBucket) available(n int) bool {
+	return b.tokens >= min(float64(n), b.rate)
+}
+
+// allowBoth takes n tokens from a and m tokens from b only if both buckets have enough tokens.
+func allowBoth(a *tokenBucket, n int, b *tokenBucket, m int) bool {
+	now := time.Now()
+	buckets := [2]*tokenBucket{a, b}
+	counts := [2]int{n, m}
+
+	for _, bucket := range buckets {
+		if nil != bucket {
+			bucket.mutex.Lock()
+			defer bucket.mutex.Unlock()
+			bucket.refill(now)
+		}
+	}
+
+	for index, bucket := range buckets {
+		if nil != bucket && !bucket.available(counts[index]) {
+			return false
+		}
+	}
+
+	for index, bucket := range buckets {
+		if nil != bucket {
+			bucket.tokens -= float64(counts[index])
+		}
+	}
+	return true
+}
+
+// reserve takes n tokens and returns the duration to wait until they are available.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	if nil == b {
+		return 0
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// retryAfter returns the duration until one token is available.
+func (b *tokenBucket) retryAfter() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter limits the inbound messages of a connection.
+type rateLimiter struct {
+	action   RateLimitAction
+	messages *tokenBucket
+	bytes    *tokenBucket
+}
+
+// newRateLimiter create a rate limiter, nil returned if no limits are specified.
+func newRateLimiter(messagesPerSecond, bytesPerSecond int, action RateLimitAction) *rateLimiter {
+	if messagesPerSecond <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		action:   action,
+		messages: newTokenBucket(messagesPerSecond),
+		bytes:    newTokenBucket(bytesPerSecond),
+	}
+}
+
+// allow reports whether the message of size can be handled, RateLimitDelay waits until the limit allows.
+func (l *rateLimiter) allow(size int) bool {
+	if RateLimitDelay == l.action {
+		if delay := max(l.messages.reserve(1), l.bytes.reserve(size)); delay > 0 {
+			time.Sleep(delay)
+		}
+		return true
+	}
+	return allowBoth(l.messages, 1, l.bytes, size)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  int
+		takes []int
+		want  []bool
+	}{
+		{name: "unlimited", rate: 0, takes: []int{1, 1000}, want: []bool{true, true}},
+		{name: "burst", rate: 3, takes: []int{1, 1, 1, 1}, want: []bool{true, true, true, false}},
+		{name: "larger than burst when full", rate: 10, takes: []int{100, 1}, want: []bool{true, false}},
+		{name: "not enough", rate: 10, takes: []int{6, 6, 4}, want: []bool{true, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := newTokenBucket(tt.rate)
+			for index, n := range tt.takes {
+				if got := bucket.allow(n); got != tt.want[index] {
+					t.Fatalf("allow #%d (%d) = %t, want %t", index, n, got, tt.want[index])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	bucket := newTokenBucket(10)
+	if delay := bucket.reserve(10); 0 != delay {
+		t.Fatalf("reserve the burst = %s, want 0", delay)
+	}
+
+	delay := bucket.reserve(5)
+	if delay < 400*time.Millisecond || delay > 500*time.Millisecond {
+		t.Fatalf("reserve = %s, want about 500ms", delay)
+	}
+
+	if retry := bucket.retryAfter(); retry < 500*time.Millisecond || retry > 600*time.Millisecond {
+		t.Fatalf("retryAfter = %s, want about 600ms", retry)
+	}
+}
+
+func TestRateLimiterDrop(t *testing.T) {
+	tests := []struct {
+		name         string
+		messages     int
+		bytes        int
+		sizes        []int
+		want         []bool
+		leftMessages float64
+	}{
+		{name: "message limit", messages: 2, sizes: []int{1, 1, 1}, want: []bool{true, true, false}},
+		{name: "byte limit keeps message tokens", messages: 3, bytes: 10, sizes: []int{8, 8, 2}, want: []bool{true, false, true}, leftMessages: 1},
+		{name: "byte limit only", bytes: 10, sizes: []int{10, 1}, want: []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(tt.messages, tt.bytes, RateLimitDrop)
+			for index, size := range tt.sizes {
+				if got := limiter.allow(size); got != tt.want[index] {
+					t.Fatalf("allow #%d (%d) = %t, want %t", index, size, got, tt.want[index])
+				}
+			}
+
+			if nil != limiter.messages && tt.leftMessages > 0 && limiter.messages.tokens < tt.leftMessages {
+				t.Fatalf("message tokens %f, want %f left", limiter.messages.tokens, tt.leftMessages)
+			}
+		})
+	}
+}
+
+func TestRateLimiterNone(t *testing.T) {
+	if nil != newRateLimiter(0, 0, RateLimitClose) {
+		t.Fatal("limiter created without limits")
+	}
+}
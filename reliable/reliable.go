@@ -0,0 +1,352 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package reliable implements the at-least-once delivery of nettyws messages.
+//
+// The reliable messages carry the message ids and are acknowledged by the peer, the
+// unacknowledged messages are retried after the timeout, the duplicates are dropped
+// before OnData. A message is acknowledged after OnData returns, so an acknowledged
+// message has been delivered. The delivery is bounded by the connection: the messages
+// pending when the connection is closed are reported StatusClosed and passed to
+// OnUndelivered, the application may send them again on a new connection and the peer
+// may receive them twice. Both sides of the connection must use the package, the
+// messages are framed with a NUL prefixed header line, the other messages are passed through:
+//
+//	\x00M <id>\n<payload>    reliable message
+//	\x00A <id>\n             acknowledgement
+package reliable
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// Status is the delivery status of a message.
+type Status int
+
+const (
+	// StatusDelivered the message is acknowledged by the peer.
+	StatusDelivered Status = iota
+	// StatusRetrying the message is resent after the timeout.
+	StatusRetrying
+	// StatusFailed the message is not acknowledged after all retries.
+	StatusFailed
+	// StatusClosed the connection is closed before the message is acknowledged,
+	// the message is passed to OnUndelivered.
+	StatusClosed
+)
+
+// String returns the name of the status.
+func (s Status) String() string {
+	switch s {
+	case StatusDelivered:
+		return "delivered"
+	case StatusRetrying:
+		return "retrying"
+	case StatusFailed:
+		return "failed"
+	default:
+		return "closed"
+	}
+}
+
+// frame kinds
+const (
+	kindMessage = 'M'
+	kindAck     = 'A'
+)
+
+// the received ids remembered for duplicate suppression
+const dedupWindow = 4096
+
+// ErrClosed is returned by Send when the connection is closed.
+var ErrClosed = errors.New("reliable: connection closed")
+
+// Reliable delivers the messages of a Websocket at least once.
+type Reliable struct {
+	timeout    time.Duration
+	maxRetries int
+	peers      sync.Map // map<nettyws.Conn, *peer> by the conn unwrapped from the middlewares
+
+	// OnStatus is called when the delivery status of the message changes.
+	OnStatus func(conn nettyws.Conn, id uint64, status Status)
+	// OnUndelivered is called with the payload of the message after StatusFailed or StatusClosed,
+	// the message may have been received by the peer without the acknowledgement.
+	OnUndelivered func(conn nettyws.Conn, id uint64, data []byte)
+}
+
+// New create the at-least-once delivery of the Websocket, the messages are resent after timeout up to
+// maxRetries times. New must be called before Listen, Open or UpgradeHTTP.
+func New(ws *nettyws.Websocket, timeout time.Duration, maxRetries int) *Reliable {
+	r := &Reliable{timeout: timeout, maxRetries: maxRetries}
+	ws.Use(r.middleware)
+	ws.UseOpen(r.open)
+	ws.UseClose(func(conn nettyws.Conn, _ error) { r.close(conn) })
+	return r
+}
+
+// Send writes the message and retries until acknowledged, the id is passed to OnStatus.
+// ErrClosed returned if the connection is closed.
+func (r *Reliable) Send(conn nettyws.Conn, data []byte) (uint64, error) {
+	p, ok := r.peer(conn)
+	if !ok {
+		return 0, ErrClosed
+	}
+
+	// the message is pending before written, the ack may arrive before Write returns
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return 0, ErrClosed
+	}
+	p.nextID++
+	id := p.nextID
+	message := frame(kindMessage, id, data)
+	pm := &pending{message: message, payload: message[len(message)-len(data):]}
+	pm.timer = time.AfterFunc(r.timeout, func() { r.retry(conn, p, id) })
+	p.pending[id] = pm
+	p.mutex.Unlock()
+
+	if err := conn.Write(message); nil != err {
+		p.mutex.Lock()
+		pm.timer.Stop()
+		delete(p.pending, id)
+		p.mutex.Unlock()
+		return 0, err
+	}
+	return id, nil
+}
+
+// Pending returns the number of unacknowledged messages of the connection.
+func (r *Reliable) Pending(conn nettyws.Conn) int {
+	if value, ok := r.peers.Load(nettyws.Unwrap(conn)); ok {
+		p := value.(*peer)
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return len(p.pending)
+	}
+	return 0
+}
+
+// pending is an unacknowledged message.
+type pending struct {
+	message []byte
+	payload []byte
+	retries int
+	timer   *time.Timer
+}
+
+// peer is the delivery state of a connection.
+type peer struct {
+	mutex   sync.Mutex
+	closed  bool
+	nextID  uint64
+	pending map[uint64]*pending
+	seen    map[uint64]struct{}
+	window  []uint64
+}
+
+// open creates the state of the connection.
+func (r *Reliable) open(conn nettyws.Conn) {
+	r.peers.Store(nettyws.Unwrap(conn), &peer{
+		pending: make(map[uint64]*pending),
+		seen:    make(map[uint64]struct{}, dedupWindow),
+		window:  make([]uint64, 0, dedupWindow),
+	})
+}
+
+// peer returns the state of the connection, false returned if closed.
+func (r *Reliable) peer(conn nettyws.Conn) (*peer, bool) {
+	value, ok := r.peers.Load(nettyws.Unwrap(conn))
+	if !ok {
+		return nil, false
+	}
+	return value.(*peer), true
+}
+
+// middleware drops the duplicates and acknowledges the reliable messages after delivered,
+// the message is not acknowledged if the next handler panics and is retried by the peer.
+func (r *Reliable) middleware(next nettyws.Handler) nettyws.Handler {
+	return func(conn nettyws.Conn, data []byte) {
+		kind, id, payload, ok := parseFrame(data)
+		if !ok {
+			next(conn, data)
+			return
+		}
+
+		switch kind {
+		case kindMessage:
+			p, ok := r.peer(conn)
+			if !ok {
+				return
+			}
+			// the messages of a connection are handled in order, the id is seen after delivered
+			if !p.seenID(id) {
+				next(conn, payload)
+				p.markSeen(id)
+			}
+			_ = conn.Write(frame(kindAck, id, nil))
+		case kindAck:
+			r.ack(conn, id)
+		}
+	}
+}
+
+// seenID reports whether the id is delivered in the window.
+func (p *peer) seenID(id uint64) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, ok := p.seen[id]
+	return ok
+}
+
+// markSeen remembers the delivered id in the window.
+func (p *peer) markSeen(id uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.seen[id]; ok {
+		return
+	}
+
+	if len(p.window) == dedupWindow {
+		delete(p.seen, p.window[0])
+		copy(p.window, p.window[1:])
+		p.window = p.window[:len(p.window)-1]
+	}
+	p.window = append(p.window, id)
+	p.seen[id] = struct{}{}
+}
+
+// ack completes the delivery of the message.
+func (r *Reliable) ack(conn nettyws.Conn, id uint64) {
+	p, ok := r.peer(conn)
+	if !ok {
+		return
+	}
+
+	p.mutex.Lock()
+	pm, ok := p.pending[id]
+	if ok {
+		pm.timer.Stop()
+		delete(p.pending, id)
+	}
+	p.mutex.Unlock()
+
+	if ok {
+		r.status(conn, id, StatusDelivered)
+	}
+}
+
+// retry resends the message or fails the delivery after all retries.
+func (r *Reliable) retry(conn nettyws.Conn, p *peer, id uint64) {
+	p.mutex.Lock()
+	pm, ok := p.pending[id]
+	if !ok {
+		p.mutex.Unlock()
+		return
+	}
+
+	status := StatusRetrying
+	if pm.retries >= r.maxRetries {
+		status = StatusFailed
+		delete(p.pending, id)
+	} else {
+		pm.retries++
+		pm.timer.Reset(r.timeout)
+	}
+	p.mutex.Unlock()
+
+	// the status is reported before the ack of the resent message
+	r.status(conn, id, status)
+	if StatusRetrying == status {
+		_ = conn.Write(pm.message)
+	} else {
+		r.undelivered(conn, id, pm.payload)
+	}
+}
+
+// close fails the pending messages of the closed connection.
+func (r *Reliable) close(conn nettyws.Conn) {
+	value, ok := r.peers.LoadAndDelete(nettyws.Unwrap(conn))
+	if !ok {
+		return
+	}
+
+	p := value.(*peer)
+	p.mutex.Lock()
+	p.closed = true
+	ids := make([]uint64, 0, len(p.pending))
+	for id, pm := range p.pending {
+		pm.timer.Stop()
+		ids = append(ids, id)
+	}
+	closed := p.pending
+	p.pending = make(map[uint64]*pending)
+	p.mutex.Unlock()
+
+	// in the order of sending
+	slices.Sort(ids)
+	for _, id := range ids {
+		r.status(conn, id, StatusClosed)
+		r.undelivered(conn, id, closed[id].payload)
+	}
+}
+
+func (r *Reliable) status(conn nettyws.Conn, id uint64, status Status) {
+	if onStatus := r.OnStatus; nil != onStatus {
+		onStatus(conn, id, status)
+	}
+}
+
+func (r *Reliable) undelivered(conn nettyws.Conn, id uint64, data []byte) {
+	if onUndelivered := r.OnUndelivered; nil != onUndelivered {
+		onUndelivered(conn, id, data)
+	}
+}
+
+// frame returns the message of the kind.
+func frame(kind byte, id uint64, payload []byte) []byte {
+	message := make([]byte, 0, len(payload)+24)
+	message = append(message, 0, kind, ' ')
+	message = strconv.AppendUint(message, id, 10)
+	message = append(message, '\n')
+	return append(message, payload...)
+}
+
+// parseFrame returns the kind, id and payload of the message.
+func parseFrame(message []byte) (kind byte, id uint64, payload []byte, ok bool) {
+	if len(message) < 4 || 0 != message[0] || ' ' != message[2] {
+		return 0, 0, nil, false
+	}
+
+	i := bytes.IndexByte(message, '\n')
+	if i < 0 {
+		return 0, 0, nil, false
+	}
+
+	id, err := strconv.ParseUint(string(message[3:i]), 10, 64)
+	if nil != err {
+		return 0, 0, nil, false
+	}
+	return message[1], id, message[i+1:], true
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reliable
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+// receiver records the messages passed to OnData by the middleware.
+type receiver struct {
+	mutex    sync.Mutex
+	received []string
+}
+
+func (r *receiver) onData(_ nettyws.Conn, data []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.received = append(r.received, string(data))
+}
+
+// newPipe connects the fake conns, the written messages are delivered synchronously to the
+// middleware of the remote side with the handler.
+func newPipe(a, b *Reliable, handlerA, handlerB nettyws.Handler) (*wstest.Conn, *wstest.Conn) {
+	connA, connB := wstest.NewConn("a"), wstest.NewConn("b")
+	connA.OnWrite = func(data []byte) error {
+		b.middleware(handlerB)(connB, data)
+		return nil
+	}
+	connB.OnWrite = func(data []byte) error {
+		a.middleware(handlerA)(connA, data)
+		return nil
+	}
+	a.open(connA)
+	b.open(connB)
+	return connA, connB
+}
+
+// statusRecorder records the statuses of OnStatus.
+type statusRecorder struct {
+	mutex    sync.Mutex
+	statuses []Status
+}
+
+func (s *statusRecorder) record(_ nettyws.Conn, _ uint64, status Status) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.statuses = append(s.statuses, status)
+}
+
+func (s *statusRecorder) wait(t *testing.T, want ...Status) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mutex.Lock()
+		n := len(s.statuses)
+		s.mutex.Unlock()
+		if n >= len(want) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(want) != len(s.statuses) {
+		t.Fatalf("statuses: %v, want %v", s.statuses, want)
+	}
+	for i := range want {
+		if want[i] != s.statuses[i] {
+			t.Fatalf("statuses: %v, want %v", s.statuses, want)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	var cases = []struct {
+		kind    byte
+		id      uint64
+		payload string
+	}{
+		{kindMessage, 1, "hello"},
+		{kindMessage, 18446744073709551615, "a\nb"},
+		{kindAck, 42, ""},
+	}
+
+	for _, c := range cases {
+		kind, id, payload, ok := parseFrame(frame(c.kind, c.id, []byte(c.payload)))
+		if !ok || c.kind != kind || c.id != id || c.payload != string(payload) {
+			t.Fatalf("frame %c %d %q: %c %d %q %v", c.kind, c.id, c.payload, kind, id, payload, ok)
+		}
+	}
+
+	for _, message := range []string{"", "hello", "\x00M 1", "\x00M x\n", "\x00M1\nhello"} {
+		if _, _, _, ok := parseFrame([]byte(message)); ok {
+			t.Fatalf("message %q parsed as frame", message)
+		}
+	}
+}
+
+func TestSeen(t *testing.T) {
+	r := &Reliable{}
+	conn := wstest.NewConn("a")
+	r.open(conn)
+	p, _ := r.peer(conn)
+
+	if p.seenID(1) {
+		t.Fatal("id seen before delivered")
+	}
+	p.markSeen(1)
+	if !p.seenID(1) {
+		t.Fatal("duplicate not dropped")
+	}
+	for id := uint64(2); id <= dedupWindow+1; id++ {
+		p.markSeen(id)
+	}
+	if p.seenID(1) {
+		t.Fatal("id out of the window not accepted")
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	var recorder statusRecorder
+	var received receiver
+	sender := &Reliable{timeout: time.Minute, OnStatus: recorder.record}
+	a, _ := newPipe(sender, &Reliable{timeout: time.Minute}, nil, received.onData)
+
+	// the ack is delivered before Send returns
+	if _, err := sender.Send(a, []byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+	recorder.wait(t, StatusDelivered)
+
+	if 0 != sender.Pending(a) || 1 != len(received.received) || "hello" != received.received[0] {
+		t.Fatalf("pending %d, received %q", sender.Pending(a), received.received)
+	}
+}
+
+func TestAckAfterDelivered(t *testing.T) {
+	var recorder statusRecorder
+	var received receiver
+	sender := &Reliable{timeout: 10 * time.Millisecond, maxRetries: 3, OnStatus: recorder.record}
+
+	// the first delivery panics before OnData returns, the message is not acknowledged
+	var panicked bool
+	a, _ := newPipe(sender, &Reliable{timeout: time.Minute}, nil, func(conn nettyws.Conn, data []byte) {
+		if !panicked {
+			panicked = true
+			panic("handler")
+		}
+		received.onData(conn, data)
+	})
+
+	func() {
+		defer func() {
+			if nil == recover() {
+				t.Fatal("the handler did not panic")
+			}
+		}()
+		_, _ = sender.Send(a, []byte("hello"))
+	}()
+	if 1 != sender.Pending(a) {
+		t.Fatal("the message is acknowledged before delivered")
+	}
+
+	// the retry is delivered and acknowledged
+	recorder.wait(t, StatusRetrying, StatusDelivered)
+	if 1 != len(received.received) || "hello" != received.received[0] {
+		t.Fatalf("received %q", received.received)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var recorder statusRecorder
+	r := &Reliable{timeout: 10 * time.Millisecond, maxRetries: 2, OnStatus: recorder.record}
+	undelivered := make(chan string, 1)
+	r.OnUndelivered = func(conn nettyws.Conn, id uint64, data []byte) {
+		undelivered <- string(data)
+	}
+	conn := wstest.NewConn("a")
+	r.open(conn)
+
+	if _, err := r.Send(conn, []byte("lost")); nil != err {
+		t.Fatal(err)
+	}
+	recorder.wait(t, StatusRetrying, StatusRetrying, StatusFailed)
+	if data := wstest.Receive(t, undelivered); "lost" != data {
+		t.Fatalf("undelivered %q, want lost", data)
+	}
+}
+
+// wrapConn is the conn passed by a middleware.
+type wrapConn struct {
+	nettyws.Conn
+}
+
+func (c *wrapConn) Unwrap() nettyws.Conn {
+	return c.Conn
+}
+
+func TestClosed(t *testing.T) {
+	var recorder statusRecorder
+	r := &Reliable{timeout: time.Minute, OnStatus: recorder.record}
+	var undelivered []string
+	r.OnUndelivered = func(conn nettyws.Conn, id uint64, data []byte) {
+		undelivered = append(undelivered, string(data))
+	}
+	conn := wstest.NewConn("a")
+
+	if _, err := r.Send(conn, []byte("hello")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send before open: %v", err)
+	}
+
+	// the wrapped conn shares the state of the conn
+	r.open(conn)
+	for _, message := range []string{"hello", "world"} {
+		if _, err := r.Send(&wrapConn{Conn: conn}, []byte(message)); nil != err {
+			t.Fatal(err)
+		}
+	}
+	if 2 != r.Pending(conn) {
+		t.Fatalf("pending %d, want 2", r.Pending(conn))
+	}
+	r.close(conn)
+	recorder.wait(t, StatusClosed, StatusClosed)
+
+	// the payloads are passed to OnUndelivered in the order of sending
+	if 2 != len(undelivered) || "hello" != undelivered[0] || "world" != undelivered[1] {
+		t.Fatalf("undelivered %q", undelivered)
+	}
+
+	// the state of the closed connection is never recreated
+	if _, err := r.Send(conn, []byte("hello")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("send after close: %v", err)
+	}
+	if _, ok := r.peer(conn); ok {
+		t.Fatal("peer recreated after close")
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	server := nettyws.NewWebsocket()
+	received := make(chan string, 2)
+	New(server, time.Second, 3)
+	server.OnData = func(conn nettyws.Conn, data []byte) {
+		received <- string(data)
+	}
+
+	client := nettyws.NewWebsocket()
+	var recorder statusRecorder
+	delivery := New(client, time.Second, 3)
+	delivery.OnStatus = recorder.record
+	conn := wstest.Open(t, client, wstest.Serve(t, server))
+
+	if _, err := delivery.Send(conn, []byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+	// the other messages are passed through
+	if err := conn.Write([]byte("plain")); nil != err {
+		t.Fatal(err)
+	}
+	if data := wstest.Receive(t, received); "hello" != data {
+		t.Fatalf("received %q, want hello", data)
+	}
+	if data := wstest.Receive(t, received); "plain" != data {
+		t.Fatalf("received %q, want plain", data)
+	}
+	recorder.wait(t, StatusDelivered)
+}
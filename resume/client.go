@@ -0,0 +1,185 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resume
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// the reconnect backoff of the client
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+// ErrClientClosed is returned by Write after the client is closed.
+var ErrClientClosed = errors.New("resume: client closed")
+
+// Client is the resumable client, it reconnects with Websocket.Open and resumes the
+// session after the connection is lost.
+type Client struct {
+	ws     *nettyws.Websocket
+	addr   string
+	stream *stream
+	mutex  sync.Mutex
+	token  string
+	closed bool
+
+	// OnSession is called when the server assigns or resumes the session, the messages
+	// not received by the server are discarded if the session is not resumed.
+	OnSession func(token string, resumed bool)
+	// OnData is called with the new data messages of the session.
+	OnData func(data []byte)
+}
+
+// NewClient create the client with options, the last bufferSize messages are replayed on resume.
+func NewClient(bufferSize int, options ...nettyws.Option) *Client {
+	c := &Client{ws: nettyws.NewWebsocket(options...), stream: newStream(bufferSize)}
+	c.ws.OnData = c.onData
+	c.ws.OnClose = c.onClose
+	return c
+}
+
+// Dial opens the connection to the address, the connection is reopened until Close is called.
+func (c *Client) Dial(addr string) error {
+	c.addr = addr
+	_, err := c.ws.Open(c.resumeURL())
+	return err
+}
+
+// Token returns the token of the current session.
+func (c *Client) Token() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.token
+}
+
+// Write writes the data message, the message is buffered for replay and
+// sent on resume if disconnected.
+func (c *Client) Write(data []byte) error {
+	c.mutex.Lock()
+	closed := c.closed
+	c.mutex.Unlock()
+
+	if closed {
+		return ErrClientClosed
+	}
+	return c.stream.write(data)
+}
+
+// Close closes the connection without resuming.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+	return c.ws.Close()
+}
+
+// resumeURL returns the address with the token and last received sequence.
+func (c *Client) resumeURL() string {
+	token := c.Token()
+	if "" == token {
+		return c.addr
+	}
+
+	u, err := url.Parse(c.addr)
+	if nil != err {
+		return c.addr
+	}
+	query := u.Query()
+	query.Set(queryToken, token)
+	query.Set(queryAck, strconv.FormatUint(c.stream.received(), 10))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (c *Client) onData(conn nettyws.Conn, data []byte) {
+	kind, fields, payload, err := parseFrame(data)
+	if nil != err {
+		return
+	}
+
+	switch kind {
+	case kindSession:
+		c.onSession(conn, fields)
+	case kindData:
+		if seq, err := parseData(fields); nil == err && c.stream.receive(seq) {
+			if onData := c.OnData; nil != onData {
+				onData(payload)
+			}
+		}
+	}
+}
+
+// onSession replays the messages not received by the server.
+func (c *Client) onSession(conn nettyws.Conn, fields []string) {
+	if 2 != len(fields) {
+		return
+	}
+	ack, err := strconv.ParseUint(fields[1], 10, 64)
+	if nil != err {
+		return
+	}
+
+	c.mutex.Lock()
+	resumed := c.token == fields[0]
+	lost := "" != c.token && !resumed
+	c.token = fields[0]
+	c.mutex.Unlock()
+
+	// the messages of the lost session are discarded
+	if lost {
+		c.stream.reset()
+	}
+
+	if err = c.stream.attach(conn, nil, ack); nil != err {
+		_ = conn.Close()
+		return
+	}
+
+	if onSession := c.OnSession; nil != onSession {
+		onSession(fields[0], resumed)
+	}
+}
+
+func (c *Client) onClose(conn nettyws.Conn, _ error) {
+	c.stream.detach(conn)
+	go c.reconnect()
+}
+
+// reconnect reopens the connection with backoff until success or closed.
+func (c *Client) reconnect() {
+	for backoff := minBackoff; ; backoff = min(2*backoff, maxBackoff) {
+		c.mutex.Lock()
+		closed := c.closed
+		c.mutex.Unlock()
+		if closed {
+			return
+		}
+
+		if _, err := c.ws.Open(c.resumeURL()); nil == err {
+			return
+		}
+		time.Sleep(backoff)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resume
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// Session is a resumable session of the server.
+type Session struct {
+	token  string
+	stream *stream
+	mutex  sync.Mutex
+	conn   nettyws.Conn
+	expiry *time.Timer
+}
+
+// Token returns the token of the session.
+func (s *Session) Token() string {
+	return s.token
+}
+
+// Conn returns the current connection of the session, nil returned if disconnected.
+func (s *Session) Conn() nettyws.Conn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.conn
+}
+
+// Write writes the data message, the message is buffered for replay and
+// sent on resume if the session is disconnected.
+func (s *Session) Write(data []byte) error {
+	return s.stream.write(data)
+}
+
+// Server serves the resumable sessions of a Websocket.
+type Server struct {
+	bufferSize int
+	ttl        time.Duration
+	sessions   sync.Map // map<token, *Session>
+	conns      sync.Map // map<nettyws.Conn, *Session> by the conn unwrapped from the middlewares
+
+	// OnOpen is called when a session is created or resumed.
+	OnOpen func(session *Session, resumed bool)
+	// OnData is called with the new data messages of the session.
+	OnData func(session *Session, data []byte)
+	// OnExpire is called when the disconnected session is not resumed in time.
+	OnExpire func(session *Session)
+}
+
+// NewServer create the server of the Websocket, the sessions are tracked by the callbacks of Websocket.UseOpen
+// and Websocket.UseClose, the OnData callback is replaced. The last bufferSize messages are replayed on resume,
+// the sessions expire after ttl since disconnected.
+func NewServer(ws *nettyws.Websocket, bufferSize int, ttl time.Duration) *Server {
+	s := &Server{bufferSize: bufferSize, ttl: ttl}
+	ws.UseOpen(s.onOpen)
+	ws.OnData = s.onData
+	ws.UseClose(s.onClose)
+	return s
+}
+
+// Session returns the session of the token.
+func (s *Server) Session(token string) (*Session, bool) {
+	session, ok := s.sessions.Load(token)
+	if !ok {
+		return nil, false
+	}
+	return session.(*Session), true
+}
+
+func (s *Server) onOpen(conn nettyws.Conn) {
+	query := conn.Request().URL.Query()
+	ack, _ := strconv.ParseUint(query.Get(queryAck), 10, 64)
+
+	session, resumed, err := s.resume(query.Get(queryToken), ack)
+	if nil != err {
+		_ = conn.WriteClose(1002, err.Error())
+		_ = conn.Close()
+		return
+	}
+	if !resumed {
+		session, ack = s.create(), 0
+	}
+
+	session.mutex.Lock()
+	session.conn = conn
+	session.mutex.Unlock()
+	s.conns.Store(nettyws.Unwrap(conn), session)
+
+	if err := session.stream.attach(conn, sessionFrame(session.token, session.stream.received()), ack); nil != err {
+		_ = conn.Close()
+		return
+	}
+
+	if onOpen := s.OnOpen; nil != onOpen {
+		onOpen(session, resumed)
+	}
+}
+
+// resume returns the session of the token if the messages after ack are replayable,
+// the ack ahead of the sent messages is a protocol error. The previous connection still
+// attached to the session is closed.
+func (s *Server) resume(token string, ack uint64) (*Session, bool, error) {
+	if "" == token {
+		return nil, false, nil
+	}
+
+	session, ok := s.Session(token)
+	if !ok {
+		return nil, false, nil
+	}
+	if ok, err := session.stream.replayable(ack); !ok {
+		return nil, false, err
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	// the session is expired
+	if nil != session.expiry && !session.expiry.Stop() {
+		return nil, false, nil
+	}
+	session.expiry = nil
+
+	// the session is still attached to the previous connection, e.g. the client reconnects
+	// before the server notices the lost connection, the new connection takes over the session
+	if previous := session.conn; nil != previous {
+		session.conn = nil
+		session.stream.detach(previous)
+		s.conns.Delete(nettyws.Unwrap(previous))
+		go func() {
+			_ = previous.WriteClose(1000, "session resumed")
+			_ = previous.Close()
+		}()
+	}
+	return session, true, nil
+}
+
+// create returns a new session.
+func (s *Server) create() *Session {
+	var token [16]byte
+	_, _ = rand.Read(token[:])
+	session := &Session{token: hex.EncodeToString(token[:]), stream: newStream(s.bufferSize)}
+	s.sessions.Store(session.token, session)
+	return session
+}
+
+func (s *Server) onData(conn nettyws.Conn, data []byte) {
+	value, ok := s.conns.Load(nettyws.Unwrap(conn))
+	if !ok {
+		return
+	}
+	session := value.(*Session)
+
+	kind, fields, payload, err := parseFrame(data)
+	if nil != err || kindData != kind {
+		return
+	}
+
+	if seq, err := parseData(fields); nil == err && session.stream.receive(seq) {
+		if onData := s.OnData; nil != onData {
+			onData(session, payload)
+		}
+	}
+}
+
+func (s *Server) onClose(conn nettyws.Conn, _ error) {
+	value, ok := s.conns.LoadAndDelete(nettyws.Unwrap(conn))
+	if !ok {
+		return
+	}
+	session := value.(*Session)
+	session.stream.detach(conn)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if nil == session.conn || nettyws.Unwrap(session.conn) != nettyws.Unwrap(conn) {
+		return
+	}
+
+	session.conn = nil
+	session.expiry = time.AfterFunc(s.ttl, func() {
+		s.sessions.Delete(session.token)
+		if onExpire := s.OnExpire; nil != onExpire {
+			onExpire(session)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resume
+
+import (
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+func TestResumeAttached(t *testing.T) {
+	ws := nettyws.NewWebsocket()
+	server := NewServer(ws, 16, time.Minute)
+	opened := make(chan bool, 2)
+	server.OnOpen = func(session *Session, resumed bool) {
+		opened <- resumed
+	}
+	url := wstest.Serve(t, ws)
+
+	// the previous connection is still attached when the client reconnects
+	sessions, closed := make(chan string, 1), make(chan error, 1)
+	previous := nettyws.NewWebsocket()
+	previous.OnData = func(conn nettyws.Conn, data []byte) {
+		if kind, fields, _, err := parseFrame(data); nil == err && kindSession == kind {
+			sessions <- fields[0]
+		}
+	}
+	previous.OnClose = func(conn nettyws.Conn, err error) {
+		closed <- err
+	}
+	conn := wstest.Open(t, previous, url)
+	token := wstest.Receive(t, sessions)
+	if wstest.Receive(t, opened) {
+		t.Fatal("the new session is resumed")
+	}
+
+	session, ok := server.Session(token)
+	if !ok {
+		t.Fatal("the session is not found")
+	}
+	if err := session.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+
+	resumed, received := make(chan bool, 1), make(chan string, 1)
+	client := NewClient(16)
+	client.token = token
+	client.OnSession = func(token string, ok bool) {
+		resumed <- ok
+	}
+	client.OnData = func(data []byte) {
+		received <- string(data)
+	}
+	defer client.Close()
+	if err := client.Dial(url); nil != err {
+		t.Fatal(err)
+	}
+
+	if !wstest.Receive(t, opened) || !wstest.Receive(t, resumed) {
+		t.Fatal("the attached session is not resumed")
+	}
+	if data := wstest.Receive(t, received); "hello" != data {
+		t.Fatalf("replayed %q, want hello", data)
+	}
+	wstest.Receive(t, closed)
+
+	// the session is written to the new connection only
+	if current := session.Conn(); nil == current || conn == current {
+		t.Fatalf("the session is attached to %v", current)
+	}
+	if err := session.Write([]byte("world")); nil != err {
+		t.Fatal(err)
+	}
+	if data := wstest.Receive(t, received); "world" != data {
+		t.Fatalf("received %q, want world", data)
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	ws := nettyws.NewWebsocket()
+	// the middleware passes a wrapped conn to OnData
+	ws.Use(func(next nettyws.Handler) nettyws.Handler {
+		return func(conn nettyws.Conn, data []byte) {
+			next(&wrapConn{Conn: conn}, data)
+		}
+	})
+	server := NewServer(ws, 16, time.Minute)
+	received := make(chan string, 1)
+	server.OnData = func(session *Session, data []byte) {
+		received <- string(data)
+	}
+
+	// the callbacks of the Websocket are kept
+	opened, closed := make(chan struct{}, 1), make(chan struct{}, 1)
+	ws.OnOpen = func(conn nettyws.Conn) {
+		opened <- struct{}{}
+	}
+	ws.OnClose = func(conn nettyws.Conn, err error) {
+		closed <- struct{}{}
+	}
+	url := wstest.Serve(t, ws)
+
+	sessions := make(chan bool, 1)
+	client := NewClient(16)
+	client.OnSession = func(token string, resumed bool) {
+		sessions <- resumed
+	}
+	if err := client.Dial(url); nil != err {
+		t.Fatal(err)
+	}
+	wstest.Receive(t, sessions)
+	wstest.Receive(t, opened)
+
+	if err := client.Write([]byte("hello")); nil != err {
+		t.Fatal(err)
+	}
+	if data := wstest.Receive(t, received); "hello" != data {
+		t.Fatalf("received %q, want hello", data)
+	}
+
+	session, ok := server.Session(client.Token())
+	if !ok {
+		t.Fatal("the session is not found")
+	}
+	_ = client.Close()
+	wstest.Receive(t, closed)
+	if nil != session.Conn() {
+		t.Fatal("the session is attached after close")
+	}
+}
+
+// wrapConn is the conn passed by a middleware.
+type wrapConn struct {
+	nettyws.Conn
+}
+
+func (c *wrapConn) Unwrap() nettyws.Conn {
+	return c.Conn
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package resume implements the session resumption of nettyws connections.
+//
+// The server assigns a token to every session, the data messages of both sides carry
+// the sequence numbers and are kept in a bounded replay buffer. The client reconnects
+// with the token and the last received sequence, then both sides replay the messages
+// the peer has not received. The messages are framed with an ASCII header line:
+//
+//	S <token> <ack>\n        server assigns or resumes the session
+//	D <seq>\n<payload>       data message
+package resume
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// the query parameters of the resume handshake
+const (
+	queryToken = "resume_token"
+	queryAck   = "resume_ack"
+)
+
+// frame kinds
+const (
+	kindSession = 'S'
+	kindData    = 'D'
+)
+
+var (
+	errBadFrame = errors.New("resume: bad frame")
+	errBadAck   = errors.New("resume: ack ahead of the sent messages")
+)
+
+// entry is a buffered data message.
+type entry struct {
+	seq     uint64
+	message []byte
+}
+
+// stream sequences the data messages of a session.
+type stream struct {
+	mutex    sync.Mutex
+	conn     nettyws.Conn
+	size     int
+	nextSeq  uint64
+	buffer   []entry
+	lastRecv uint64
+}
+
+func newStream(size int) *stream {
+	return &stream{size: size, buffer: make([]entry, 0, size)}
+}
+
+// write buffers the data message and writes it if connected.
+func (s *stream) write(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextSeq++
+	message := dataFrame(s.nextSeq, data)
+	if len(s.buffer) == s.size && s.size > 0 {
+		copy(s.buffer, s.buffer[1:])
+		s.buffer = s.buffer[:len(s.buffer)-1]
+	}
+	if s.size > 0 {
+		s.buffer = append(s.buffer, entry{seq: s.nextSeq, message: message})
+	}
+
+	if nil != s.conn {
+		return s.conn.Write(message)
+	}
+	return nil
+}
+
+// replayable reports whether the messages after ack are all buffered,
+// errBadAck returned if ack is ahead of the sent messages.
+func (s *stream) replayable(ack uint64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if ack > s.nextSeq {
+		return false, errBadAck
+	}
+	return ack == s.nextSeq || (len(s.buffer) > 0 && s.buffer[0].seq <= ack+1), nil
+}
+
+// attach writes the header and replays the messages after ack to the connection.
+func (s *stream) attach(conn nettyws.Conn, header []byte, ack uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn = conn
+	if nil != header {
+		if err := conn.Write(header); nil != err {
+			return err
+		}
+	}
+
+	for _, e := range s.buffer {
+		if e.seq > ack {
+			if err := conn.Write(e.message); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// detach stops writing to the connection.
+func (s *stream) detach(conn nettyws.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if nil != s.conn && nettyws.Unwrap(s.conn) == nettyws.Unwrap(conn) {
+		s.conn = nil
+	}
+}
+
+// reset discards the buffered messages and the sequences.
+func (s *stream) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nextSeq, s.lastRecv, s.buffer = 0, 0, s.buffer[:0]
+}
+
+// received returns the last received sequence.
+func (s *stream) received() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastRecv
+}
+
+// receive reports whether the data message is new, the replayed duplicates are dropped.
+func (s *stream) receive(seq uint64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if seq <= s.lastRecv {
+		return false
+	}
+	s.lastRecv = seq
+	return true
+}
+
+// dataFrame returns the data message.
+func dataFrame(seq uint64, data []byte) []byte {
+	message := make([]byte, 0, len(data)+24)
+	message = append(message, kindData, ' ')
+	message = strconv.AppendUint(message, seq, 10)
+	message = append(message, '\n')
+	return append(message, data...)
+}
+
+// sessionFrame returns the session message.
+func sessionFrame(token string, ack uint64) []byte {
+	return []byte(string(kindSession) + " " + token + " " + strconv.FormatUint(ack, 10) + "\n")
+}
+
+// parseFrame returns the kind, fields of the header and the payload.
+func parseFrame(message []byte) (kind byte, fields []string, payload []byte, err error) {
+	i := bytes.IndexByte(message, '\n')
+	if i < 0 {
+		return 0, nil, nil, errBadFrame
+	}
+
+	fields = strings.Fields(string(message[:i]))
+	if 0 == len(fields) || 1 != len(fields[0]) {
+		return 0, nil, nil, errBadFrame
+	}
+	return fields[0][0], fields[1:], message[i+1:], nil
+}
+
+// parseData returns the sequence and payload of the data message.
+func parseData(fields []string) (uint64, error) {
+	if 1 != len(fields) {
+		return 0, errBadFrame
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
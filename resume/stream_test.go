@@ -0,0 +1,96 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resume
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	kind, fields, payload, err := parseFrame(dataFrame(42, []byte("hello\nworld")))
+	if nil != err || kindData != kind || !bytes.Equal([]byte("hello\nworld"), payload) {
+		t.Fatalf("data frame: %c %v %q %v", kind, fields, payload, err)
+	}
+	if seq, err := parseData(fields); nil != err || 42 != seq {
+		t.Fatalf("seq: %d %v", seq, err)
+	}
+
+	kind, fields, _, err = parseFrame(sessionFrame("token", 7))
+	if nil != err || kindSession != kind || 2 != len(fields) || "token" != fields[0] || "7" != fields[1] {
+		t.Fatalf("session frame: %c %v %v", kind, fields, err)
+	}
+
+	for _, message := range []string{"", "D 1", "\n", "DD 1\n"} {
+		if _, _, _, err := parseFrame([]byte(message)); nil == err {
+			t.Fatalf("bad frame %q accepted", message)
+		}
+	}
+	for _, fields := range [][]string{nil, {"1", "2"}, {"x"}} {
+		if _, err := parseData(fields); nil == err {
+			t.Fatalf("bad data %v accepted", fields)
+		}
+	}
+}
+
+func TestReplayable(t *testing.T) {
+	s := newStream(2)
+	for i := 0; i < 4; i++ {
+		_ = s.write([]byte("message"))
+	}
+
+	// the messages 3 and 4 are buffered
+	var cases = []struct {
+		ack uint64
+		ok  bool
+		err error
+	}{
+		{0, false, nil},
+		{1, false, nil},
+		{2, true, nil},
+		{3, true, nil},
+		{4, true, nil},
+		{5, false, errBadAck},
+	}
+
+	for _, c := range cases {
+		ok, err := s.replayable(c.ack)
+		if c.ok != ok || c.err != err {
+			t.Fatalf("ack %d: %v %v, want %v %v", c.ack, ok, err, c.ok, c.err)
+		}
+	}
+
+	s.reset()
+	if ok, err := s.replayable(0); !ok || nil != err {
+		t.Fatalf("reset: %v %v", ok, err)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	s := newStream(0)
+	for _, c := range []struct {
+		seq uint64
+		ok  bool
+	}{{1, true}, {1, false}, {3, true}, {2, false}, {4, true}} {
+		if ok := s.receive(c.seq); c.ok != ok {
+			t.Fatalf("seq %d: %v", c.seq, ok)
+		}
+	}
+	if 4 != s.received() {
+		t.Fatalf("received: %d", s.received())
+	}
+}
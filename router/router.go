@@ -0,0 +1,257 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package router routes the messages of nettyws by the type of envelope:
+//
+//	{"type": "chat.send", "id": "1", "payload": {...}}
+//
+// The replies are flagged and only matched against the pending requests by id:
+//
+//	{"type": "chat.send", "id": "1", "reply": true, "payload": {...}}
+//
+// The envelopes are encoded with the codec of the connection, see nettyws.WithCodec,
+// the codec must support struct values such as JSON and MessagePack.
+package router
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// Envelope is the routed message.
+type Envelope struct {
+	Type    string      `json:"type" msgpack:"type"`
+	ID      string      `json:"id,omitempty" msgpack:"id,omitempty"`
+	Reply   bool        `json:"reply,omitempty" msgpack:"reply,omitempty"`
+	Payload interface{} `json:"payload,omitempty" msgpack:"payload,omitempty"`
+	Error   *Error      `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// Error is the error reply of the envelope.
+type Error struct {
+	Code    int    `json:"code" msgpack:"code"`
+	Message string `json:"message" msgpack:"message"`
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	// ErrBadEnvelope is replied when the message is not an envelope.
+	ErrBadEnvelope = &Error{Code: 400, Message: "bad envelope"}
+	// ErrBadPayload is replied when the payload cannot be decoded.
+	ErrBadPayload = &Error{Code: 400, Message: "bad payload"}
+	// ErrUnknownType is replied when no handler for the type.
+	ErrUnknownType = &Error{Code: 404, Message: "unknown type"}
+	// ErrClosed is returned by the pending requests when the connection is closed.
+	ErrClosed = errors.New("router: connection closed")
+)
+
+// Message is a received envelope.
+type Message struct {
+	Type  string
+	ID    string
+	conn  nettyws.Conn
+	data  []byte
+	Error *Error
+}
+
+// Decode decodes the payload to v.
+func (m *Message) Decode(v interface{}) error {
+	return m.conn.Codec().Unmarshal(m.data, &Envelope{Payload: v})
+}
+
+// Reply sends the payload with the type and id of the message.
+func (m *Message) Reply(payload interface{}) error {
+	return nettyws.WriteValue(m.conn, &Envelope{Type: m.Type, ID: m.ID, Reply: true, Payload: payload})
+}
+
+// HandlerFunc handles the message, the returned error is replied with the type and id of the message,
+// the *Error is replied as is, the others are replied with code 500.
+type HandlerFunc func(conn nettyws.Conn, message *Message) error
+
+// pendingKey is the key of a pending request, the conn is unwrapped from the middlewares.
+type pendingKey struct {
+	conn nettyws.Conn
+	id   string
+}
+
+// Router routes the messages to the handlers by type.
+type Router struct {
+	mutex    sync.RWMutex
+	handlers map[string]HandlerFunc
+	fallback HandlerFunc
+	seq      atomic.Uint64
+	pending  sync.Map // map<pendingKey, chan *Message>
+}
+
+// New create a router, the unknown types are replied with ErrUnknownType.
+func New() *Router {
+	return &Router{handlers: make(map[string]HandlerFunc)}
+}
+
+// On registers the handler of the type.
+func (r *Router) On(typ string, handler HandlerFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handlers[typ] = handler
+}
+
+// Fallback sets the handler of the unknown types.
+func (r *Router) Fallback(handler HandlerFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.fallback = handler
+}
+
+// Bind routes the messages of the Websocket connections, the OnData callback is replaced
+// and the pending requests are failed by a close callback of Websocket.UseClose.
+func (r *Router) Bind(ws *nettyws.Websocket) {
+	ws.OnData = r.OnData
+	ws.UseClose(r.OnClose)
+}
+
+// Handle registers the handler of the type with the decoded payload, the non-nil reply is sent
+// with the type and id of the message.
+func Handle[T any](r *Router, typ string, handler func(conn nettyws.Conn, payload T) (reply interface{}, err error)) {
+	r.On(typ, func(conn nettyws.Conn, message *Message) error {
+		var payload T
+		if err := message.Decode(&payload); nil != err {
+			return ErrBadPayload
+		}
+
+		reply, err := handler(conn, payload)
+		if nil != err {
+			return err
+		}
+		if nil != reply {
+			return message.Reply(reply)
+		}
+		return nil
+	})
+}
+
+// Send sends the envelope of the type and payload.
+func Send(conn nettyws.Conn, typ string, payload interface{}) error {
+	return nettyws.WriteValue(conn, &Envelope{Type: typ, Payload: payload})
+}
+
+// Request sends the envelope of the type and payload with a new id and waits for the reply,
+// the error reply is returned as *Error. The OnData of the router must receive the messages of conn,
+// ErrClosed is returned if the connection is closed before the reply.
+func (r *Router) Request(ctx context.Context, conn nettyws.Conn, typ string, payload interface{}) (*Message, error) {
+	key := pendingKey{conn: nettyws.Unwrap(conn), id: "r" + strconv.FormatUint(r.seq.Add(1), 10)}
+	reply := make(chan *Message, 1)
+	r.pending.Store(key, reply)
+	defer r.pending.Delete(key)
+
+	if err := nettyws.WriteValue(conn, &Envelope{Type: typ, ID: key.id, Payload: payload}); nil != err {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-conn.Context().Done():
+		return nil, ErrClosed
+	case message, ok := <-reply:
+		if !ok {
+			return nil, ErrClosed
+		}
+		if nil != message.Error {
+			return message, message.Error
+		}
+		return message, nil
+	}
+}
+
+// OnData routes the message, use as the Websocket.OnData callback.
+func (r *Router) OnData(conn nettyws.Conn, data []byte) {
+	message := &Message{conn: conn, data: data}
+	var envelope struct {
+		Type  string `json:"type" msgpack:"type"`
+		ID    string `json:"id,omitempty" msgpack:"id,omitempty"`
+		Reply bool   `json:"reply,omitempty" msgpack:"reply,omitempty"`
+		Error *Error `json:"error,omitempty" msgpack:"error,omitempty"`
+	}
+	err := conn.Codec().Unmarshal(data, &envelope)
+	message.Type, message.ID, message.Error = envelope.Type, envelope.ID, envelope.Error
+
+	// the replies are never dispatched to the handlers
+	if nil == err && (envelope.Reply || nil != envelope.Error) {
+		r.resolve(message)
+		return
+	}
+
+	if nil != err || "" == envelope.Type {
+		r.replyError(message, ErrBadEnvelope)
+		return
+	}
+
+	r.mutex.RLock()
+	handler, ok := r.handlers[message.Type]
+	if !ok {
+		handler = r.fallback
+	}
+	r.mutex.RUnlock()
+
+	if nil == handler {
+		r.replyError(message, ErrUnknownType)
+		return
+	}
+
+	if err := handler(conn, message); nil != err {
+		r.replyError(message, err)
+	}
+}
+
+// OnClose fails the pending requests of the connection, use as a close callback of Websocket.UseClose.
+func (r *Router) OnClose(conn nettyws.Conn, _ error) {
+	conn = nettyws.Unwrap(conn)
+	r.pending.Range(func(key, _ interface{}) bool {
+		if key.(pendingKey).conn == conn {
+			if reply, ok := r.pending.LoadAndDelete(key); ok {
+				close(reply.(chan *Message))
+			}
+		}
+		return true
+	})
+}
+
+// resolve delivers the reply to the pending request of the id, the unmatched replies are dropped.
+func (r *Router) resolve(message *Message) {
+	if reply, ok := r.pending.LoadAndDelete(pendingKey{conn: nettyws.Unwrap(message.conn), id: message.ID}); ok {
+		// the read buffer is reused after OnData returns
+		message.data = append([]byte(nil), message.data...)
+		reply.(chan *Message) <- message
+	}
+}
+
+// replyError sends the error reply with the type and id of the message.
+func (r *Router) replyError(message *Message, err error) {
+	var replyErr *Error
+	if !errors.As(err, &replyErr) {
+		replyErr = &Error{Code: 500, Message: err.Error()}
+	}
+	_ = nettyws.WriteValue(message.conn, &Envelope{Type: message.Type, ID: message.ID, Reply: true, Error: replyErr})
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+// envelopes decodes the written envelopes of the connection.
+func envelopes(t *testing.T, conn *wstest.Conn) []Envelope {
+	t.Helper()
+	var written []Envelope
+	for _, data := range conn.Written() {
+		var envelope Envelope
+		if err := json.Unmarshal(data, &envelope); nil != err {
+			t.Fatal(err)
+		}
+		written = append(written, envelope)
+	}
+	return written
+}
+
+func TestRouterOnData(t *testing.T) {
+	r := New()
+	Handle(r, "echo", func(conn nettyws.Conn, payload string) (interface{}, error) {
+		return payload, nil
+	})
+	r.On("fail", func(conn nettyws.Conn, message *Message) error {
+		return errors.New("failed")
+	})
+
+	tests := []struct {
+		name      string
+		data      string
+		wantReply *Envelope
+	}{
+		{name: "handled", data: `{"type":"echo","id":"1","payload":"hi"}`, wantReply: &Envelope{Type: "echo", ID: "1", Reply: true, Payload: "hi"}},
+		{name: "handler error", data: `{"type":"fail","id":"2"}`, wantReply: &Envelope{Type: "fail", ID: "2", Reply: true, Error: &Error{Code: 500, Message: "failed"}}},
+		{name: "bad payload", data: `{"type":"echo","id":"3","payload":1}`, wantReply: &Envelope{Type: "echo", ID: "3", Reply: true, Error: ErrBadPayload}},
+		{name: "unknown type", data: `{"type":"missing","id":"4"}`, wantReply: &Envelope{Type: "missing", ID: "4", Reply: true, Error: ErrUnknownType}},
+		{name: "bad envelope", data: `[]`, wantReply: &Envelope{Reply: true, Error: ErrBadEnvelope}},
+		{name: "missing type", data: `{"id":"5"}`, wantReply: &Envelope{ID: "5", Reply: true, Error: ErrBadEnvelope}},
+		{name: "unmatched reply", data: `{"type":"echo","id":"6","reply":true,"payload":"hi"}`},
+		{name: "error reply is not bounced", data: `{"type":"missing","id":"7","reply":true,"error":{"code":404,"message":"unknown type"}}`},
+		{name: "error without reply flag is not dispatched", data: `{"type":"echo","id":"8","error":{"code":500,"message":"failed"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := wstest.NewConn(tt.name)
+			r.OnData(conn, []byte(tt.data))
+
+			written := envelopes(t, conn)
+			if nil == tt.wantReply {
+				if 0 != len(written) {
+					t.Fatalf("replied %+v, want nothing", written)
+				}
+				return
+			}
+
+			if 1 != len(written) {
+				t.Fatalf("replied %d envelopes, want 1", len(written))
+			}
+			got, want := written[0], *tt.wantReply
+			if got.Type != want.Type || got.ID != want.ID || got.Reply != want.Reply || got.Payload != want.Payload ||
+				(nil == got.Error) != (nil == want.Error) || (nil != got.Error && *got.Error != *want.Error) {
+				t.Fatalf("replied %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRouterRequest(t *testing.T) {
+	r := New()
+	conn := wstest.NewConn("peer")
+
+	// the peer echoes the request as a reply
+	conn.OnWrite = func(data []byte) error {
+		var envelope Envelope
+		_ = json.Unmarshal(data, &envelope)
+		envelope.Reply = true
+		if "fail" == envelope.Type {
+			envelope.Error = ErrUnknownType
+		}
+		reply, _ := json.Marshal(&envelope)
+		go r.OnData(conn, reply)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	message, err := r.Request(ctx, conn, "echo", "hi")
+	if nil != err {
+		t.Fatal(err)
+	}
+	var payload string
+	if err := message.Decode(&payload); nil != err || "hi" != payload {
+		t.Fatalf("reply payload %q, %v", payload, err)
+	}
+
+	if _, err := r.Request(ctx, conn, "fail", nil); !errors.As(err, new(*Error)) {
+		t.Fatalf("request error = %v, want *Error", err)
+	}
+
+	conn.OnWrite = nil
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelTimeout()
+	if _, err := r.Request(timeout, conn, "echo", "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request error = %v, want deadline exceeded", err)
+	}
+}
+
+// wrapConn is the conn passed by a middleware.
+type wrapConn struct {
+	nettyws.Conn
+}
+
+func (c *wrapConn) Unwrap() nettyws.Conn {
+	return c.Conn
+}
+
+func TestRouterClose(t *testing.T) {
+	r := New()
+	conn := wstest.NewConn("peer")
+	sent := make(chan struct{}, 1)
+	conn.OnWrite = func([]byte) error {
+		sent <- struct{}{}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Request(context.Background(), &wrapConn{Conn: conn}, "echo", "hi")
+		done <- err
+	}()
+	wstest.Receive(t, sent)
+
+	// the pending request of the wrapped conn is failed by the close callback
+	r.OnClose(conn, nil)
+	if err := wstest.Receive(t, done); !errors.Is(err, ErrClosed) {
+		t.Fatalf("request error = %v, want ErrClosed", err)
+	}
+	if _, ok := r.pending.Load(pendingKey{conn: conn, id: "r1"}); ok {
+		t.Fatal("the pending request is not removed")
+	}
+}
+
+func TestRouterLoopback(t *testing.T) {
+	server := New()
+	Handle(server, "echo", func(conn nettyws.Conn, payload string) (interface{}, error) {
+		return payload, nil
+	})
+	serverWs := nettyws.NewWebsocket()
+	server.Bind(serverWs)
+
+	client := New()
+	clientWs := nettyws.NewWebsocket()
+	client.Bind(clientWs)
+	conn := wstest.Open(t, clientWs, wstest.Serve(t, serverWs))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	message, err := client.Request(ctx, conn, "echo", "hi")
+	if nil != err {
+		t.Fatal(err)
+	}
+	var payload string
+	if err := message.Decode(&payload); nil != err || "hi" != payload {
+		t.Fatalf("reply payload %q, %v", payload, err)
+	}
+
+	var replyErr *Error
+	if _, err := client.Request(ctx, conn, "missing", nil); !errors.As(err, &replyErr) || *ErrUnknownType != *replyErr {
+		t.Fatalf("request error = %v, want ErrUnknownType", err)
+	}
+}
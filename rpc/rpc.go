@@ -0,0 +1,326 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rpc implements the bidirectional request-response calls over nettyws connections,
+// both sides of a connection can register methods and call the methods of the peer.
+//
+// The frames are encoded with the codec of the connection, see nettyws.WithCodec,
+// the codec must support struct values such as JSON and MessagePack:
+//
+//	{"kind": 0, "id": 1, "method": "add", "params": [1, 2]}   call
+//	{"kind": 1, "id": 1, "result": 3}                         reply
+//	{"kind": 1, "id": 1, "error": {"code": 404, ...}}         error reply
+//	{"kind": 2, "id": 1}                                      cancel the call
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// frame kinds
+const (
+	kindCall = iota
+	kindReply
+	kindCancel
+)
+
+type frame struct {
+	Kind   int         `json:"kind" msgpack:"kind"`
+	ID     uint64      `json:"id" msgpack:"id"`
+	Method string      `json:"method,omitempty" msgpack:"method,omitempty"`
+	Params interface{} `json:"params,omitempty" msgpack:"params,omitempty"`
+	Result interface{} `json:"result,omitempty" msgpack:"result,omitempty"`
+	Error  *Error      `json:"error,omitempty" msgpack:"error,omitempty"`
+}
+
+// Error is the error reply of the call.
+type Error struct {
+	Code    int    `json:"code" msgpack:"code"`
+	Message string `json:"message" msgpack:"message"`
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	// ErrMethodNotFound is replied when the method is not registered.
+	ErrMethodNotFound = &Error{Code: 404, Message: "method not found"}
+	// ErrBadParams is replied when the params cannot be decoded.
+	ErrBadParams = &Error{Code: 400, Message: "bad params"}
+	// ErrInternal is replied when the handler panics.
+	ErrInternal = &Error{Code: 500, Message: "internal error"}
+	// ErrClosed is returned by the pending calls when the connection is closed.
+	ErrClosed = errors.New("rpc: connection closed")
+)
+
+// Params is the params of a call.
+type Params struct {
+	conn nettyws.Conn
+	data []byte
+}
+
+// Decode decodes the params to v.
+func (p *Params) Decode(v interface{}) error {
+	return p.conn.Codec().Unmarshal(p.data, &frame{Params: v})
+}
+
+// Reply is the result of a call.
+type Reply struct {
+	conn nettyws.Conn
+	data []byte
+	err  *Error
+}
+
+// Decode decodes the result to v.
+func (r *Reply) Decode(v interface{}) error {
+	return r.conn.Codec().Unmarshal(r.data, &frame{Result: v})
+}
+
+// HandlerFunc handles the call, the ctx is canceled if the caller cancels the call or the connection is closed.
+// The returned *Error is replied as is, the others are replied with code 500.
+type HandlerFunc func(ctx context.Context, conn nettyws.Conn, params *Params) (result interface{}, err error)
+
+// Endpoint serves and calls the methods on the connections.
+type Endpoint struct {
+	timeout  time.Duration
+	mutex    sync.RWMutex
+	handlers map[string]HandlerFunc
+	peers    sync.Map // map<nettyws.Conn, *Peer> by the conn unwrapped from the middlewares
+}
+
+// New create an endpoint, the timeout applies to the calls without deadline, zero means no timeout.
+func New(timeout time.Duration) *Endpoint {
+	return &Endpoint{timeout: timeout, handlers: make(map[string]HandlerFunc)}
+}
+
+// Register registers the handler of the method.
+func (e *Endpoint) Register(method string, handler HandlerFunc) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.handlers[method] = handler
+}
+
+// Register registers the handler of the method with the decoded params.
+func Register[P, R any](e *Endpoint, method string, handler func(ctx context.Context, conn nettyws.Conn, params P) (R, error)) {
+	e.Register(method, func(ctx context.Context, conn nettyws.Conn, params *Params) (interface{}, error) {
+		var p P
+		if err := params.Decode(&p); nil != err {
+			return nil, ErrBadParams
+		}
+		return handler(ctx, conn, p)
+	})
+}
+
+// Bind serves the calls of the Websocket connections, the OnData callback is replaced
+// and the connections are cleaned up by a close callback of Websocket.UseClose.
+func (e *Endpoint) Bind(ws *nettyws.Websocket) {
+	ws.OnData = e.OnData
+	ws.UseClose(e.OnClose)
+}
+
+// Peer returns the peer of the connection to call the remote methods.
+func (e *Endpoint) Peer(conn nettyws.Conn) *Peer {
+	key := nettyws.Unwrap(conn)
+	if peer, ok := e.peers.Load(key); ok {
+		return peer.(*Peer)
+	}
+
+	peer := newPeer(e, conn)
+	select {
+	case <-conn.Context().Done():
+		// the closed connection is never cleaned up by OnClose
+		peer.close()
+		return peer
+	default:
+	}
+
+	if actual, loaded := e.peers.LoadOrStore(key, peer); loaded {
+		return actual.(*Peer)
+	}
+	return peer
+}
+
+// OnData serves the frames of the connection, use as the Websocket.OnData callback.
+func (e *Endpoint) OnData(conn nettyws.Conn, data []byte) {
+	var head struct {
+		Kind   int    `json:"kind" msgpack:"kind"`
+		ID     uint64 `json:"id" msgpack:"id"`
+		Method string `json:"method,omitempty" msgpack:"method,omitempty"`
+		Error  *Error `json:"error,omitempty" msgpack:"error,omitempty"`
+	}
+	if err := conn.Codec().Unmarshal(data, &head); nil != err {
+		return
+	}
+
+	// the params and result are decoded after OnData returns, copy the reused read buffer
+	peer := e.Peer(conn)
+	switch head.Kind {
+	case kindCall:
+		peer.serve(head.ID, head.Method, append([]byte(nil), data...))
+	case kindReply:
+		peer.reply(head.ID, &Reply{conn: conn, data: append([]byte(nil), data...), err: head.Error})
+	case kindCancel:
+		peer.cancel(head.ID)
+	}
+}
+
+// OnClose fails the pending calls and cancels the serving calls of the connection,
+// use as the Websocket.OnClose callback.
+func (e *Endpoint) OnClose(conn nettyws.Conn, _ error) {
+	if peer, ok := e.peers.LoadAndDelete(nettyws.Unwrap(conn)); ok {
+		peer.(*Peer).close()
+	}
+}
+
+// Peer is the remote side of a connection.
+type Peer struct {
+	endpoint *Endpoint
+	conn     nettyws.Conn
+	ctx      context.Context
+	stop     context.CancelFunc
+	nextID   atomic.Uint64
+	pending  sync.Map // map<uint64, chan *Reply>
+	serving  sync.Map // map<uint64, context.CancelFunc>
+}
+
+func newPeer(endpoint *Endpoint, conn nettyws.Conn) *Peer {
+	peer := &Peer{endpoint: endpoint, conn: conn}
+	peer.ctx, peer.stop = context.WithCancel(conn.Context())
+	return peer
+}
+
+// Conn returns the connection of the peer.
+func (p *Peer) Conn() nettyws.Conn {
+	return p.conn
+}
+
+// Call calls the method of the peer and waits the reply, the call is canceled on the peer
+// if ctx is done before the reply.
+func (p *Peer) Call(ctx context.Context, method string, params interface{}) (*Reply, error) {
+	if _, ok := ctx.Deadline(); !ok && p.endpoint.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.endpoint.timeout)
+		defer cancel()
+	}
+
+	id := p.nextID.Add(1)
+	replyCh := make(chan *Reply, 1)
+	p.pending.Store(id, replyCh)
+	defer p.pending.Delete(id)
+
+	if err := nettyws.WriteValue(p.conn, &frame{Kind: kindCall, ID: id, Method: method, Params: params}); nil != err {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replyCh:
+		if nil != reply.err {
+			return nil, reply.err
+		}
+		return reply, nil
+	case <-ctx.Done():
+		_ = nettyws.WriteValue(p.conn, &frame{Kind: kindCancel, ID: id})
+		return nil, ctx.Err()
+	case <-p.ctx.Done():
+		return nil, ErrClosed
+	}
+}
+
+// Notify calls the method of the peer without reply.
+func (p *Peer) Notify(method string, params interface{}) error {
+	return nettyws.WriteValue(p.conn, &frame{Kind: kindCall, Method: method, Params: params})
+}
+
+// serve runs the handler of the call in a new goroutine, the calls with zero id are notifications.
+// The panic of the handler is recovered and replied with ErrInternal.
+func (p *Peer) serve(id uint64, method string, data []byte) {
+	p.endpoint.mutex.RLock()
+	handler, ok := p.endpoint.handlers[method]
+	p.endpoint.mutex.RUnlock()
+
+	if !ok {
+		p.replyError(id, ErrMethodNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	if 0 != id {
+		p.serving.Store(id, cancel)
+	}
+
+	go func() {
+		defer cancel()
+		defer p.serving.Delete(id)
+		defer func() {
+			if nil != recover() && nil == ctx.Err() {
+				p.replyError(id, ErrInternal)
+			}
+		}()
+
+		result, err := handler(ctx, p.conn, &Params{conn: p.conn, data: data})
+		switch {
+		case 0 == id || nil != ctx.Err():
+			// the notification or the canceled call
+		case nil != err:
+			p.replyError(id, err)
+		default:
+			_ = nettyws.WriteValue(p.conn, &frame{Kind: kindReply, ID: id, Result: result})
+		}
+	}()
+}
+
+// replyError replies the error of the call.
+func (p *Peer) replyError(id uint64, err error) {
+	if 0 == id {
+		return
+	}
+
+	var replyErr *Error
+	if !errors.As(err, &replyErr) {
+		replyErr = &Error{Code: 500, Message: err.Error()}
+	}
+	_ = nettyws.WriteValue(p.conn, &frame{Kind: kindReply, ID: id, Error: replyErr})
+}
+
+// reply delivers the reply to the pending call, the reply of the canceled call is dropped.
+func (p *Peer) reply(id uint64, reply *Reply) {
+	if replyCh, ok := p.pending.Load(id); ok {
+		select {
+		case replyCh.(chan *Reply) <- reply:
+		default:
+		}
+	}
+}
+
+// cancel cancels the serving call.
+func (p *Peer) cancel(id uint64) {
+	if cancel, ok := p.serving.Load(id); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
+// close fails the pending calls and cancels the serving calls.
+func (p *Peer) close() {
+	p.stop()
+}
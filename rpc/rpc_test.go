@@ -0,0 +1,202 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+	"github.com/go-netty/go-netty-ws/internal/wstest"
+)
+
+// newPipe connects the endpoints, the written messages are delivered to the endpoint of the remote
+// side and the read buffer is scrubbed after OnData returns as the reused buffer of nettyws.
+func newPipe(a, b *Endpoint) (*wstest.Conn, *wstest.Conn) {
+	connA, connB := wstest.NewConn("a"), wstest.NewConn("b")
+	deliver := func(endpoint *Endpoint, conn *wstest.Conn) func(data []byte) error {
+		return func(data []byte) error {
+			go func() {
+				endpoint.OnData(conn, data)
+				for index := range data {
+					data[index] = 0
+				}
+			}()
+			return nil
+		}
+	}
+	connA.OnWrite, connB.OnWrite = deliver(b, connB), deliver(a, connA)
+	return connA, connB
+}
+
+func TestCall(t *testing.T) {
+	server := New(time.Second)
+	Register(server, "add", func(ctx context.Context, conn nettyws.Conn, args [2]int) (int, error) {
+		// decoded after OnData returned
+		return args[0] + args[1], nil
+	})
+	Register(server, "fail", func(ctx context.Context, conn nettyws.Conn, args int) (int, error) {
+		return 0, &Error{Code: 418, Message: "teapot"}
+	})
+	Register(server, "block", func(ctx context.Context, conn nettyws.Conn, args int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	endpoint := New(time.Second)
+	client, _ := newPipe(endpoint, server)
+	defer client.Close()
+	peer := endpoint.Peer(client)
+
+	tests := []struct {
+		name    string
+		method  string
+		params  interface{}
+		timeout time.Duration
+		want    int
+		wantErr error
+	}{
+		{name: "result", method: "add", params: [2]int{1, 2}, want: 3},
+		{name: "error", method: "fail", params: 1, wantErr: &Error{Code: 418, Message: "teapot"}},
+		{name: "not found", method: "missing", wantErr: ErrMethodNotFound},
+		{name: "bad params", method: "add", params: "x", wantErr: ErrBadParams},
+		{name: "timeout", method: "block", params: 1, timeout: 20 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			reply, err := peer.Call(ctx, tt.method, tt.params)
+			if nil != tt.wantErr {
+				var replyErr, wantErr *Error
+				if errors.As(tt.wantErr, &wantErr) && (!errors.As(err, &replyErr) || *replyErr != *wantErr) {
+					t.Fatalf("call error = %v, want %v", err, tt.wantErr)
+				}
+				if nil == wantErr && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("call error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if nil != err {
+				t.Fatal(err)
+			}
+			var result int
+			if err := reply.Decode(&result); nil != err || result != tt.want {
+				t.Fatalf("result = %d, %v, want %d", result, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallClosed(t *testing.T) {
+	server := New(0)
+	Register(server, "block", func(ctx context.Context, conn nettyws.Conn, args int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	endpoint := New(0)
+	client, _ := newPipe(endpoint, server)
+	peer := endpoint.Peer(client)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		endpoint.OnClose(client, nil)
+		_ = client.Close()
+	}()
+
+	if _, err := peer.Call(context.Background(), "block", 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("call error = %v, want ErrClosed", err)
+	}
+}
+
+// wrapConn is the conn passed by a middleware.
+type wrapConn struct {
+	nettyws.Conn
+}
+
+func (c *wrapConn) Unwrap() nettyws.Conn {
+	return c.Conn
+}
+
+func TestPeerUnwrap(t *testing.T) {
+	endpoint := New(0)
+	conn := wstest.NewConn("a")
+	peer := endpoint.Peer(&wrapConn{Conn: conn})
+	if endpoint.Peer(conn) != peer || endpoint.Peer(&wrapConn{Conn: conn}) != peer {
+		t.Fatal("the wrapped conn has another peer")
+	}
+
+	endpoint.OnClose(&wrapConn{Conn: conn}, nil)
+	if _, ok := endpoint.peers.Load(conn); ok {
+		t.Fatal("the peer is not removed by OnClose")
+	}
+}
+
+func TestCallPanic(t *testing.T) {
+	server := New(time.Second)
+	Register(server, "panic", func(ctx context.Context, conn nettyws.Conn, args int) (int, error) {
+		panic("boom")
+	})
+
+	endpoint := New(time.Second)
+	client, _ := newPipe(endpoint, server)
+	defer client.Close()
+
+	var replyErr *Error
+	if _, err := endpoint.Peer(client).Call(context.Background(), "panic", 1); !errors.As(err, &replyErr) || *ErrInternal != *replyErr {
+		t.Fatalf("call error = %v, want ErrInternal", err)
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	server := New(time.Second)
+	Register(server, "add", func(ctx context.Context, conn nettyws.Conn, args [2]int) (int, error) {
+		return args[0] + args[1], nil
+	})
+	serverWs := nettyws.NewWebsocket()
+	server.Bind(serverWs)
+
+	client := New(time.Second)
+	clientWs := nettyws.NewWebsocket()
+	client.Bind(clientWs)
+	conn := wstest.Open(t, clientWs, wstest.Serve(t, serverWs))
+
+	reply, err := client.Peer(conn).Call(context.Background(), "add", [2]int{1, 2})
+	if nil != err {
+		t.Fatal(err)
+	}
+	var result int
+	if err := reply.Decode(&result); nil != err || 3 != result {
+		t.Fatalf("result = %d, %v, want 3", result, err)
+	}
+
+	// the pending calls fail when the connection is closed
+	_ = conn.Close()
+	if _, err := client.Peer(conn).Call(context.Background(), "add", [2]int{1, 2}); nil == err {
+		t.Fatal("call on the closed connection succeeded")
+	}
+}
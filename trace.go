@@ -0,0 +1,197 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Tracer traces the handshakes and messages of the Websocket,
+// the tracing package provides an OpenTelemetry compatible implementation.
+type Tracer interface {
+	// Extract returns the context carries the remote span context of the handshake request headers.
+	Extract(ctx context.Context, header http.Header) context.Context
+	// Start starts a span as the child of the span in ctx, the returned function ends the span with the error.
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, func(err error))
+}
+
+// span names
+const (
+	spanUpgrade   = "websocket.upgrade"
+	spanOpen      = "websocket.open"
+	spanDial      = "websocket.dial"
+	spanTLS       = "websocket.tls"
+	spanHandshake = "websocket.handshake"
+	spanMessage   = "websocket.message"
+)
+
+// valueContext looks up the values first, the deadline and cancellation are from the parent.
+type valueContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valueContext) Value(key interface{}) interface{} {
+	if value := c.values.Value(key); nil != value {
+		return value
+	}
+	return c.Context.Value(key)
+}
+
+type openTraceKey struct{}
+
+// openTrace traces the phases of Websocket.Open.
+type openTrace struct {
+	tracer       Tracer
+	ctx          context.Context
+	end          func(err error)
+	mutex        sync.Mutex
+	endHandshake func(err error)
+}
+
+// startOpen starts the span of Websocket.Open, the returned context carries the trace for the dialer.
+func startOpen(tracer Tracer, ctx context.Context, addr string) (context.Context, *openTrace) {
+	trace := &openTrace{tracer: tracer}
+	trace.ctx, trace.end = tracer.Start(ctx, spanOpen, slog.String("url", addr))
+	return context.WithValue(trace.ctx, openTraceKey{}, trace), trace
+}
+
+// phase starts the span of a phase.
+func (t *openTrace) phase(name string, attrs ...slog.Attr) func(err error) {
+	_, end := t.tracer.Start(t.ctx, name, attrs...)
+	return end
+}
+
+// startHandshake starts the span of the handshake phase.
+func (t *openTrace) startHandshake() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if nil == t.endHandshake {
+		t.endHandshake = t.phase(spanHandshake)
+	}
+}
+
+// finish ends the spans of the handshake phase and Websocket.Open.
+func (t *openTrace) finish(err error) {
+	t.mutex.Lock()
+	endHandshake := t.endHandshake
+	t.mutex.Unlock()
+
+	if nil != endHandshake {
+		endHandshake(err)
+	}
+	t.end(err)
+}
+
+// traceConn is the dialed connection of a traced Websocket.Open.
+type traceConn struct {
+	net.Conn
+	trace *openTrace
+}
+
+// failedConn fails the handshake request of the dialer with the tls handshake error.
+type failedConn struct {
+	net.Conn
+	err error
+}
+
+func (c failedConn) Read([]byte) (int, error) {
+	return 0, c.err
+}
+
+func (c failedConn) Write([]byte) (int, error) {
+	return 0, c.err
+}
+
+func (c *traceConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// traceOf returns the trace of the dialed connection.
+func traceOf(conn net.Conn) *openTrace {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tc, ok := conn.(*traceConn); ok {
+		return tc.trace
+	}
+	return nil
+}
+
+// traceDialer traces the dial, tls and handshake phases of the dialer.
+func (ws *Websocket) traceDialer() {
+	dialer := &ws.options.Dialer
+
+	netDial := dialer.NetDial
+	if nil == netDial {
+		netDial = (&net.Dialer{}).DialContext
+	}
+
+	dialer.NetDial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		trace, _ := ctx.Value(openTraceKey{}).(*openTrace)
+		if nil == trace {
+			return netDial(ctx, network, addr)
+		}
+
+		end := trace.phase(spanDial, slog.String("network", network), slog.String("addr", addr))
+		conn, err := netDial(ctx, network, addr)
+		if end(err); nil != err {
+			return nil, err
+		}
+		return &traceConn{Conn: conn, trace: trace}, nil
+	}
+
+	dialer.TLSClient = func(conn net.Conn, hostname string) net.Conn {
+		config := dialer.TLSConfig
+		if nil == config {
+			config = &tls.Config{}
+		} else {
+			config = config.Clone()
+		}
+
+		if "" == config.ServerName {
+			config.ServerName = hostname
+		}
+
+		tlsConn := tls.Client(conn, config)
+		if trace := traceOf(conn); nil != trace {
+			end := trace.phase(spanTLS, slog.String("server_name", config.ServerName))
+			if err := tlsConn.HandshakeContext(trace.ctx); nil != err {
+				end(err)
+				return failedConn{Conn: tlsConn, err: err}
+			}
+			end(nil)
+		}
+		return tlsConn
+	}
+
+	wrapConn := dialer.WrapConn
+	dialer.WrapConn = func(conn net.Conn) net.Conn {
+		if trace := traceOf(conn); nil != trace {
+			trace.startHandshake()
+		}
+		if nil != wrapConn {
+			conn = wrapConn(conn)
+		}
+		return conn
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordTracer records the ended spans.
+type recordTracer struct {
+	mutex sync.Mutex
+	spans map[string]error
+}
+
+func (t *recordTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	return ctx
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, func(err error)) {
+	return ctx, func(err error) {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if nil == t.spans {
+			t.spans = make(map[string]error)
+		}
+		t.spans[name] = err
+	}
+}
+
+func (t *recordTracer) span(name string) (error, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	err, ok := t.spans[name]
+	return err, ok
+}
+
+func TestTraceOpenTLS(t *testing.T) {
+	server := httptest.NewTLSServer(NewWebsocket())
+	defer server.Close()
+	url := "wss" + strings.TrimPrefix(server.URL, "https")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	tests := []struct {
+		name   string
+		config *tls.Config
+		fail   bool
+	}{
+		{name: "trusted", config: &tls.Config{RootCAs: roots}},
+		{name: "untrusted", config: nil, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &recordTracer{}
+			client := NewWebsocket(WithTracer(tracer, false), WithClientTLS(tt.config))
+			defer client.Close()
+
+			conn, err := client.Open(url)
+			tlsErr, ok := tracer.span(spanTLS)
+			if !ok {
+				t.Fatal("the tls span is not ended")
+			}
+
+			if !tt.fail {
+				if nil != err || nil != tlsErr {
+					t.Fatalf("open error %v, tls span error %v", err, tlsErr)
+				}
+				_ = conn.Close()
+				return
+			}
+
+			// the handshake request fails with the tls error instead of writing to the broken connection
+			var verifyErr *tls.CertificateVerificationError
+			if !errors.As(tlsErr, &verifyErr) {
+				t.Fatalf("tls span error %v", tlsErr)
+			}
+			if nil == err || !strings.Contains(err.Error(), tlsErr.Error()) {
+				t.Fatalf("open error %v, want the tls error %v", err, tlsErr)
+			}
+			if openErr, _ := tracer.span(spanOpen); nil == openErr {
+				t.Fatal("the open span is ended without error")
+			}
+		})
+	}
+}
+
+func TestFailedConn(t *testing.T) {
+	handshakeErr := errors.New("tls: handshake failure")
+	conn := failedConn{err: handshakeErr}
+
+	if n, err := conn.Write([]byte("GET / HTTP/1.1\r\n")); 0 != n || handshakeErr != err {
+		t.Fatalf("write returns %d, %v", n, err)
+	}
+	if n, err := conn.Read(make([]byte, 16)); 0 != n || handshakeErr != err {
+		t.Fatalf("read returns %d, %v", n, err)
+	}
+}
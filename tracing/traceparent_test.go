@@ -0,0 +1,89 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const spanID = "00f067aa0ba902b7"
+
+	tests := []struct {
+		name        string
+		traceparent string
+		wantOK      bool
+		wantSampled bool
+	}{
+		{name: "sampled", traceparent: "00-" + traceID + "-" + spanID + "-01", wantOK: true, wantSampled: true},
+		{name: "not sampled", traceparent: "00-" + traceID + "-" + spanID + "-00", wantOK: true},
+		{name: "surrounding spaces", traceparent: " 00-" + traceID + "-" + spanID + "-01 ", wantOK: true, wantSampled: true},
+		{name: "future version with more parts", traceparent: "01-" + traceID + "-" + spanID + "-01-extra", wantOK: true, wantSampled: true},
+		{name: "version 00 with more parts", traceparent: "00-" + traceID + "-" + spanID + "-01-extra"},
+		{name: "invalid version", traceparent: "ff-" + traceID + "-" + spanID + "-01"},
+		{name: "upper case", traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01"},
+		{name: "short trace id", traceparent: "00-" + traceID[2:] + "-" + spanID + "-01"},
+		{name: "zero trace id", traceparent: "00-00000000000000000000000000000000-" + spanID + "-01"},
+		{name: "zero span id", traceparent: "00-" + traceID + "-0000000000000000-01"},
+		{name: "not hex", traceparent: "00-" + traceID + "-" + spanID + "-zz"},
+		{name: "missing parts", traceparent: "00-" + traceID},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.traceparent)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseTraceparent(%q) ok = %t, want %t", tt.traceparent, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if sc.IsSampled() != tt.wantSampled {
+				t.Fatalf("sampled = %t, want %t", sc.IsSampled(), tt.wantSampled)
+			}
+			if want := "00-" + traceID + "-" + spanID + "-" + tt.traceparent[len(tt.traceparent)-2:]; "00" == tt.traceparent[:2] && sc.Traceparent() != want {
+				t.Fatalf("Traceparent() = %s, want %s", sc.Traceparent(), want)
+			}
+		})
+	}
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set("tracestate", "vendor=value")
+
+	ctx := TraceContext{}.Extract(context.Background(), header)
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok || !sc.Remote || "vendor=value" != sc.TraceState {
+		t.Fatalf("extracted %+v, %t", sc, ok)
+	}
+
+	injected := http.Header{}
+	TraceContext{}.Inject(ctx, injected)
+	if injected.Get("traceparent") != header.Get("traceparent") || injected.Get("tracestate") != header.Get("tracestate") {
+		t.Fatalf("injected %v, want %v", injected, header)
+	}
+
+	if ctx := (TraceContext{}).Extract(context.Background(), http.Header{"Traceparent": {"invalid"}}); nil != ctx.Value(spanContextKey{}) {
+		t.Fatal("invalid traceparent extracted")
+	}
+}
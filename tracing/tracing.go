@@ -0,0 +1,109 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tracing implements nettyws.Tracer over an OpenTelemetry compatible Tracer.
+//
+// The Tracer and Span interfaces follow the shape of the OpenTelemetry trace API,
+// an adapter of go.opentelemetry.io/otel/trace.Tracer only needs to convert the
+// attributes and the remote SpanContext:
+//
+//	func (a otelAdapter) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+//		if sc, ok := tracing.SpanContextFromContext(ctx); ok && sc.Remote {
+//			ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+//				TraceID: sc.TraceID, SpanID: sc.SpanID, TraceFlags: trace.TraceFlags(sc.TraceFlags), Remote: true,
+//			}))
+//		}
+//		ctx, span := a.tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//
+// The spans are:
+//
+//	websocket.upgrade    server side upgrade of UpgradeHTTP and Listen
+//	websocket.open       client side Open, with the children:
+//	websocket.dial       dial the address
+//	websocket.tls        tls handshake of wss
+//	websocket.handshake  websocket handshake
+//	websocket.message    inbound message, enabled by nettyws.WithTracer
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	nettyws "github.com/go-netty/go-netty-ws"
+)
+
+// Tracer starts spans, compatible with the OpenTelemetry Tracer.
+type Tracer interface {
+	// Start a span as the child of the span in ctx.
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span is a started span, compatible with the OpenTelemetry Span.
+type Span interface {
+	// SetAttributes sets the attributes of the span.
+	SetAttributes(attrs ...slog.Attr)
+	// RecordError records the error of the span.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// Propagator extracts the span context from the handshake request headers,
+// compatible with the OpenTelemetry TextMapPropagator over http.Header.
+type Propagator interface {
+	// Extract returns a copy of ctx carries the span context of the header.
+	Extract(ctx context.Context, header http.Header) context.Context
+	// Inject set the span context of ctx to the header.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// wsTracer implements nettyws.Tracer.
+type wsTracer struct {
+	tracer     Tracer
+	propagator Propagator
+}
+
+// New create a nettyws.Tracer with the tracer and propagator, the W3C TraceContext
+// propagator is used if propagator is nil.
+func New(tracer Tracer, propagator Propagator) nettyws.Tracer {
+	if nil == propagator {
+		propagator = TraceContext{}
+	}
+	return &wsTracer{tracer: tracer, propagator: propagator}
+}
+
+// Extract implements nettyws.Tracer.
+func (t *wsTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	return t.propagator.Extract(ctx, header)
+}
+
+// Start implements nettyws.Tracer.
+func (t *wsTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, name)
+	if len(attrs) > 0 {
+		span.SetAttributes(attrs...)
+	}
+
+	return ctx, func(err error) {
+		if nil != err {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
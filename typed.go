@@ -0,0 +1,128 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+)
+
+// ErrNoSession is returned when the Conn wrapped by a middleware does not implement Unwrapper.
+var ErrNoSession = errors.New("nettyws: session not found, the conn wrapper must implement Unwrapper")
+
+// TypedConn is a websocket connection with the typed session.
+type TypedConn[S any] interface {
+	Conn
+	// Session returns the session created by the factory on open.
+	Session() S
+}
+
+// SessionFactory creates the session of the connection on open, the handshake
+// request of the server connection is available from conn.Request().
+type SessionFactory[S any] func(conn Conn) S
+
+type typedConn[S any] struct {
+	Conn
+	session S
+}
+
+// Session returns the session created by the factory on open.
+func (c *typedConn[S]) Session() S {
+	return c.session
+}
+
+// Unwrap returns the wrapped Conn.
+func (c *typedConn[S]) Unwrap() Conn {
+	return c.Conn
+}
+
+// TypedWebsocket is a Websocket with the typed session of connections.
+type TypedWebsocket[S any] struct {
+	*Websocket
+	factory SessionFactory[S]
+
+	OnOpen  func(conn TypedConn[S])
+	OnData  func(conn TypedConn[S], data []byte)
+	OnClose func(conn TypedConn[S], err error)
+}
+
+// NewTyped create websocket instance with the session factory and options.
+func NewTyped[S any](factory SessionFactory[S], options ...Option) *TypedWebsocket[S] {
+	tws := &TypedWebsocket[S]{Websocket: NewWebsocket(options...), factory: factory}
+	tws.Websocket.OnOpen = tws.onOpen
+	tws.Websocket.OnData = tws.onData
+	tws.Websocket.OnClose = tws.onClose
+	return tws
+}
+
+// typed returns the typed connection of conn, the session is stored in the websocket connection
+// under the wrappers of middlewares.
+func (tws *TypedWebsocket[S]) typed(conn Conn) (*typedConn[S], error) {
+	wc := unwrapConn(conn)
+	if nil == wc {
+		return nil, ErrNoSession
+	}
+
+	tc, ok := wc.session.Load().(*typedConn[S])
+	if !ok {
+		return nil, ErrNoSession
+	}
+
+	// keep the wrapper of middleware
+	if conn != tc.Conn {
+		return &typedConn[S]{Conn: conn, session: tc.session}, nil
+	}
+	return tc, nil
+}
+
+func (tws *TypedWebsocket[S]) onOpen(conn Conn) {
+	tc := &typedConn[S]{Conn: conn}
+	if nil != tws.factory {
+		tc.session = tws.factory(conn)
+	}
+	if wc := unwrapConn(conn); nil != wc {
+		wc.session.Store(tc)
+	}
+
+	if onOpen := tws.OnOpen; nil != onOpen {
+		onOpen(tc)
+	}
+}
+
+func (tws *TypedWebsocket[S]) onData(conn Conn, data []byte) {
+	tc, err := tws.typed(conn)
+	if nil != err {
+		tws.metrics.Error(err)
+		_ = conn.WriteClose(1011, err.Error())
+		_ = conn.Close()
+		return
+	}
+
+	if onData := tws.OnData; nil != onData {
+		onData(tc, data)
+	}
+}
+
+func (tws *TypedWebsocket[S]) onClose(conn Conn, err error) {
+	tc, typedErr := tws.typed(conn)
+	if nil != typedErr {
+		tc = &typedConn[S]{Conn: conn}
+	}
+
+	if onClose := tws.OnClose; nil != onClose {
+		onClose(tc, err)
+	}
+}
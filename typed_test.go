@@ -0,0 +1,70 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"errors"
+	"testing"
+)
+
+// wrappedConn is a Conn wrapper of middleware implements Unwrapper.
+type wrappedConn struct {
+	Conn
+}
+
+func (c wrappedConn) Unwrap() Conn {
+	return c.Conn
+}
+
+// opaqueConn is a Conn wrapper of middleware without Unwrapper.
+type opaqueConn struct {
+	Conn
+}
+
+func TestTypedSession(t *testing.T) {
+	tws := &TypedWebsocket[string]{factory: func(conn Conn) string { return "alice" }}
+	conn := &wsConn{}
+	tws.onOpen(conn)
+
+	tests := []struct {
+		name    string
+		conn    Conn
+		wantErr error
+	}{
+		{name: "conn", conn: conn},
+		{name: "unwrapper", conn: wrappedConn{Conn: conn}},
+		{name: "nested unwrapper", conn: wrappedConn{Conn: wrappedConn{Conn: conn}}},
+		{name: "opaque wrapper", conn: opaqueConn{Conn: conn}, wantErr: ErrNoSession},
+		{name: "unwrapper of opaque wrapper", conn: wrappedConn{Conn: opaqueConn{Conn: conn}}, wantErr: ErrNoSession},
+		{name: "no session", conn: &wsConn{}, wantErr: ErrNoSession},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := tws.typed(tt.conn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("typed error = %v, want %v", err, tt.wantErr)
+			}
+			if nil != err {
+				return
+			}
+			if "alice" != tc.Session() || tt.conn != tc.Unwrap() {
+				t.Fatalf("typed = %q on %v, want alice on the passed conn", tc.Session(), tc.Unwrap())
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+// frameHandler is called for each parsed frame, the payload is nil unless captured.
+type frameHandler func(header ws.Header, payload []byte)
+
+// frameParser parses the websocket frames from the byte stream of one direction.
+type frameParser struct {
+	handshake bool   // skipping the http handshake
+	matched   int    // matched bytes of the handshake end
+	header    []byte // pending header bytes
+	current   ws.Header
+	remain    int64
+	capture   int // max payload bytes to capture
+	payload   []byte
+	onFrame   frameHandler
+}
+
+var handshakeEnd = []byte("\r\n\r\n")
+
+// newFrameParser create a frame parser, the http handshake will be skipped first if handshake is true.
+func newFrameParser(handshake bool, capture int, onFrame frameHandler) *frameParser {
+	return &frameParser{handshake: handshake, header: make([]byte, 0, ws.MaxHeaderSize), capture: capture, onFrame: onFrame}
+}
+
+// feed the bytes of the stream.
+func (p *frameParser) feed(b []byte) {
+	for len(b) > 0 {
+		switch {
+		case p.handshake:
+			for len(b) > 0 && p.handshake {
+				if b[0] == handshakeEnd[p.matched] {
+					p.matched++
+				} else if p.matched = 0; b[0] == handshakeEnd[0] {
+					p.matched = 1
+				}
+				p.handshake = p.matched < len(handshakeEnd)
+				b = b[1:]
+			}
+		case p.remain > 0:
+			n := int(min(p.remain, int64(len(b))))
+			if room := p.capture - len(p.payload); room > 0 {
+				p.payload = append(p.payload, b[:min(n, room)]...)
+			}
+			p.remain -= int64(n)
+			b = b[n:]
+			if 0 == p.remain {
+				p.emit()
+			}
+		default:
+			b = p.feedHeader(b)
+		}
+	}
+}
+
+// feedHeader consume the header bytes, returns the remaining bytes.
+func (p *frameParser) feedHeader(b []byte) []byte {
+	for len(b) > 0 {
+		p.header = append(p.header, b[0])
+		b = b[1:]
+
+		if size := headerSize(p.header); len(p.header) == size {
+			header, err := ws.ReadHeader(bytes.NewReader(p.header))
+			p.header = p.header[:0]
+			if nil != err {
+				// unexpected stream, stop parsing
+				p.onFrame = nil
+				return nil
+			}
+
+			p.current, p.remain = header, header.Length
+			if 0 == p.remain {
+				p.emit()
+			}
+			return b
+		}
+	}
+	return b
+}
+
+func (p *frameParser) emit() {
+	payload := p.payload
+	if nil != payload && p.current.Masked {
+		ws.Cipher(payload, p.current.Mask, 0)
+	}
+	if nil != p.onFrame {
+		p.onFrame(p.current, payload)
+	}
+	p.payload = nil
+}
+
+// headerSize returns the size of the frame header, 0 returned if the size is unknown yet.
+func headerSize(header []byte) int {
+	if len(header) < 2 {
+		return 0
+	}
+
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		size += 4
+	}
+	return size
+}
+
+// wireStats is the frame level statistics of a connection.
+type wireStats struct {
+	framesIn     atomic.Int64
+	framesOut    atomic.Int64
+	wireBytesIn  atomic.Int64
+	wireBytesOut atomic.Int64
+	pingAt       atomic.Int64
+	pingRTT      atomic.Int64
+}
+
+func (s *wireStats) onFrameIn(header ws.Header) {
+	s.framesIn.Add(1)
+	switch {
+	case header.OpCode == ws.OpPong:
+		if pingAt := s.pingAt.Swap(0); pingAt > 0 {
+			s.pingRTT.Store(time.Now().UnixNano() - pingAt)
+		}
+	case !header.OpCode.IsControl():
+		s.wireBytesIn.Add(header.Length)
+	}
+}
+
+func (s *wireStats) onFrameOut(header ws.Header) {
+	s.framesOut.Add(1)
+	switch {
+	case header.OpCode == ws.OpPing:
+		s.pingAt.Store(time.Now().UnixNano())
+	case !header.OpCode.IsControl():
+		s.wireBytesOut.Add(header.Length)
+	}
+}
+
+// wireConn observes the frames of the underlying connection.
+type wireConn struct {
+	net.Conn
+	in    *frameParser
+	out   *frameParser
+	stats wireStats
+}
+
+// newWireConn create a wire connection, the client connection skips the handshake of both directions,
+// the server connection skips the handshake response only. The frames are traced with the payload
+// truncated to capture bytes if trace is not nil.
+func newWireConn(conn net.Conn, client bool, trace FrameTraceFunc, capture int) *wireConn {
+	wc := &wireConn{Conn: conn}
+	remoteAddr := conn.RemoteAddr().String()
+	if nil == trace {
+		capture = 0
+	}
+
+	wc.in = newFrameParser(client, capture, func(header ws.Header, payload []byte) {
+		wc.stats.onFrameIn(header)
+		if nil != trace {
+			trace(remoteAddr, FrameIn, frameHeader(header), payload)
+		}
+	})
+
+	wc.out = newFrameParser(true, capture, func(header ws.Header, payload []byte) {
+		wc.stats.onFrameOut(header)
+		if nil != trace {
+			trace(remoteAddr, FrameOut, frameHeader(header), payload)
+		}
+	})
+	return wc
+}
+
+func (c *wireConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		c.in.feed(b[:n])
+	}
+	return
+}
+
+func (c *wireConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	if n > 0 {
+		c.out.feed(b[:n])
+	}
+	return
+}
+
+type wireSlotKey struct{}
+
+// wireSlot carries the wire connection through the context of the handshake request or the dial,
+// from the wrapping of the net.Conn to the creation of the Conn.
+type wireSlot struct {
+	conn atomic.Pointer[wireConn]
+}
+
+// attach the wire connection to the slot.
+func (s *wireSlot) attach(wc *wireConn) net.Conn {
+	s.conn.Store(wc)
+	return wc
+}
+
+// wireOf returns the wire connection attached to the slot of the context.
+func wireOf(ctx context.Context) *wireConn {
+	if slot, ok := ctx.Value(wireSlotKey{}).(*wireSlot); ok {
+		return slot.conn.Load()
+	}
+	return nil
+}
+
+// slotConn is a dialed connection with the slot of the dial context.
+type slotConn struct {
+	net.Conn
+	slot *wireSlot
+}
+
+func (c *slotConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// slotOf returns the slot of the dialed connection under the tls or trace wrappers.
+func slotOf(conn net.Conn) *wireSlot {
+	for {
+		switch c := conn.(type) {
+		case *slotConn:
+			return c.slot
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+}
+
+// wireDialer observes the frames of the connections dialed with a slot in the context.
+func (ws *Websocket) wireDialer() {
+	dialer := &ws.options.Dialer
+
+	netDial := dialer.NetDial
+	if nil == netDial {
+		netDial = (&net.Dialer{}).DialContext
+	}
+
+	dialer.NetDial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := netDial(ctx, network, addr)
+		if slot, ok := ctx.Value(wireSlotKey{}).(*wireSlot); ok && nil == err {
+			conn = &slotConn{Conn: conn, slot: slot}
+		}
+		return conn, err
+	}
+
+	dialer.WrapConn = func(conn net.Conn) net.Conn {
+		if slot := slotOf(conn); nil != slot {
+			return slot.attach(ws.newWire(conn, true))
+		}
+		return conn
+	}
+}
+
+// newWire create the wire connection with the frame trace options.
+func (ws *Websocket) newWire(conn net.Conn, client bool) *wireConn {
+	return newWireConn(conn, client, ws.opts.frameTrace, ws.opts.frameTracePayload)
+}
+
+// bufferedConn reads the connection through the hijacked buffer.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// hijackWriter wraps the hijacked connection of the http.ResponseWriter.
+type hijackWriter struct {
+	http.ResponseWriter
+	wrap func(conn net.Conn) net.Conn
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if nil != err {
+		return conn, rw, err
+	}
+
+	wc := w.wrap(&bufferedConn{Conn: conn, reader: rw.Reader})
+	return wc, bufio.NewReadWriter(bufio.NewReader(wc), bufio.NewWriter(wc)), nil
+}
+
+func (w *hijackWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
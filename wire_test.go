@@ -0,0 +1,204 @@
+/*
+ * Copyright 2023 the go-netty project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nettyws
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gobwas/ws"
+)
+
+// encodeFrame encode the frame, the payload is masked if mask is not zero.
+func encodeFrame(t *testing.T, fin bool, opCode ws.OpCode, mask [4]byte, payload []byte) []byte {
+	header := ws.Header{Fin: fin, OpCode: opCode, Length: int64(len(payload))}
+	if header.Masked = [4]byte{} != mask; header.Masked {
+		header.Mask = mask
+		payload = append([]byte(nil), payload...)
+		ws.Cipher(payload, mask, 0)
+	}
+
+	var buffer bytes.Buffer
+	if err := ws.WriteHeader(&buffer, header); nil != err {
+		t.Fatal(err)
+	}
+	buffer.Write(payload)
+	return buffer.Bytes()
+}
+
+type parsedFrame struct {
+	header  ws.Header
+	payload string
+}
+
+func TestFrameParser(t *testing.T) {
+	mask := [4]byte{1, 2, 3, 4}
+	medium := strings.Repeat("m", 300)
+	large := strings.Repeat("l", 70000)
+
+	tests := []struct {
+		name      string
+		handshake string
+		frames    [][]byte
+		capture   int
+		chunk     int // feed size, the whole stream at once if zero
+		want      []parsedFrame
+	}{
+		{
+			name:   "unmasked",
+			frames: [][]byte{encodeFrame(t, true, ws.OpText, [4]byte{}, []byte("hello"))},
+			want:   []parsedFrame{{header: ws.Header{Fin: true, OpCode: ws.OpText, Length: 5}, payload: "hello"}},
+		},
+		{
+			name:   "masked",
+			frames: [][]byte{encodeFrame(t, true, ws.OpBinary, mask, []byte("hello"))},
+			want:   []parsedFrame{{header: ws.Header{Fin: true, OpCode: ws.OpBinary, Masked: true, Mask: mask, Length: 5}, payload: "hello"}},
+		},
+		{
+			name: "fragmented",
+			frames: [][]byte{
+				encodeFrame(t, false, ws.OpText, mask, []byte("hel")),
+				encodeFrame(t, true, ws.OpContinuation, mask, []byte("lo")),
+			},
+			chunk: 1,
+			want: []parsedFrame{
+				{header: ws.Header{OpCode: ws.OpText, Masked: true, Mask: mask, Length: 3}, payload: "hel"},
+				{header: ws.Header{Fin: true, OpCode: ws.OpContinuation, Masked: true, Mask: mask, Length: 2}, payload: "lo"},
+			},
+		},
+		{
+			name:   "16-bit length",
+			frames: [][]byte{encodeFrame(t, true, ws.OpText, mask, []byte(medium))},
+			chunk:  7,
+			want:   []parsedFrame{{header: ws.Header{Fin: true, OpCode: ws.OpText, Masked: true, Mask: mask, Length: 300}, payload: medium}},
+		},
+		{
+			name:    "64-bit length captured",
+			frames:  [][]byte{encodeFrame(t, true, ws.OpBinary, [4]byte{}, []byte(large))},
+			capture: 16,
+			chunk:   4096,
+			want:    []parsedFrame{{header: ws.Header{Fin: true, OpCode: ws.OpBinary, Length: 70000}, payload: large[:16]}},
+		},
+		{
+			name:      "handshake skipped",
+			handshake: "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n",
+			frames: [][]byte{
+				encodeFrame(t, true, ws.OpPing, [4]byte{}, nil),
+				encodeFrame(t, true, ws.OpClose, [4]byte{}, []byte{3, 232}),
+			},
+			chunk: 3,
+			want: []parsedFrame{
+				{header: ws.Header{Fin: true, OpCode: ws.OpPing}},
+				{header: ws.Header{Fin: true, OpCode: ws.OpClose, Length: 2}, payload: "\x03\xe8"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := []byte(tt.handshake)
+			for _, frame := range tt.frames {
+				stream = append(stream, frame...)
+			}
+
+			capture := tt.capture
+			if 0 == capture {
+				capture = len(stream)
+			}
+
+			var got []parsedFrame
+			parser := newFrameParser("" != tt.handshake, capture, func(header ws.Header, payload []byte) {
+				got = append(got, parsedFrame{header: header, payload: string(payload)})
+			})
+
+			chunk := tt.chunk
+			if 0 == chunk {
+				chunk = len(stream)
+			}
+			for len(stream) > 0 {
+				n := min(chunk, len(stream))
+				parser.feed(stream[:n])
+				stream = stream[n:]
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("parsed %d frames, want %d", len(got), len(tt.want))
+			}
+			for index, frame := range got {
+				if frame.header != tt.want[index].header || frame.payload != tt.want[index].payload {
+					t.Fatalf("frame #%d = %+v %q, want %+v %q", index, frame.header, frame.payload, tt.want[index].header, tt.want[index].payload)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   int
+	}{
+		{header: []byte{0x81}, want: 0},
+		{header: []byte{0x81, 5}, want: 2},
+		{header: []byte{0x81, 0x85}, want: 6},
+		{header: []byte{0x81, 126}, want: 4},
+		{header: []byte{0x81, 0xfe}, want: 8},
+		{header: []byte{0x82, 127}, want: 10},
+		{header: []byte{0x82, 0xff}, want: 14},
+	}
+
+	for _, tt := range tests {
+		if got := headerSize(tt.header); got != tt.want {
+			t.Errorf("headerSize(%x) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestWireStats(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	conn := newWireConn(local, true, nil, 0)
+	conn.in.handshake, conn.out.handshake = false, false
+
+	conn.out.feed(encodeFrame(t, true, ws.OpText, [4]byte{9, 9, 9, 9}, []byte("hello")))
+	conn.out.feed(encodeFrame(t, true, ws.OpPing, [4]byte{9, 9, 9, 9}, nil))
+	conn.in.feed(encodeFrame(t, true, ws.OpPong, [4]byte{}, nil))
+	conn.in.feed(encodeFrame(t, true, ws.OpBinary, [4]byte{}, []byte("hi")))
+
+	stats := &conn.stats
+	if 2 != stats.framesOut.Load() || 2 != stats.framesIn.Load() || 5 != stats.wireBytesOut.Load() || 2 != stats.wireBytesIn.Load() {
+		t.Fatalf("frames out %d in %d, bytes out %d in %d", stats.framesOut.Load(), stats.framesIn.Load(), stats.wireBytesOut.Load(), stats.wireBytesIn.Load())
+	}
+	if stats.pingRTT.Load() <= 0 {
+		t.Fatal("ping rtt not measured")
+	}
+}
+
+func TestWireSlot(t *testing.T) {
+	slot := &wireSlot{}
+	dialed := &slotConn{slot: slot}
+	if got := slotOf(&traceConn{Conn: dialed}); got != slot {
+		t.Fatal("slot not found under the trace connection")
+	}
+	if nil != slotOf(&traceConn{}) {
+		t.Fatal("slot found without a slot connection")
+	}
+}